@@ -6,10 +6,18 @@ import (
 	"math"
 )
 
+type BadOptions struct {
+	// InstanceType is the type of the instances created by the algorithm, "default" if empty
+	InstanceType string `json:"instance_type"`
+	// MinInstances is the number of instances kept in each cloud
+	MinInstances int `json:"min_instances"`
+}
+
 type BadAlgorithm struct {
+	Options BadOptions
 }
 
-func (BadAlgorithm) Run(input autoscale.AlgorithmInput, startTime time.Time) (autoscale.AlgorithmOutput, error) {
+func (b BadAlgorithm) Run(input autoscale.AlgorithmInput, startTime time.Time) (autoscale.AlgorithmOutput, error) {
 	var out autoscale.AlgorithmOutput
 	queueMap := make(map[string][]autoscale.AlgorithmJob)
 	emptyTagJobs := make([]autoscale.AlgorithmJob, 0)
@@ -27,7 +35,8 @@ func (BadAlgorithm) Run(input autoscale.AlgorithmInput, startTime time.Time) (au
 		shortestCloud := ""
 		var shortest int64
 		shortest = math.MaxInt64
-		for key, cloud := range input.Clouds {
+		for _, key := range input.Clouds.Names() {
+			cloud := input.Clouds[key]
 			if queue, ok := queueMap[key]; ok {
 				cost := cloud.GetTotalCost(queue, startTime)
 				duration, err := cloud.GetTotalDuration(queue, startTime)
@@ -70,53 +79,62 @@ func (BadAlgorithm) Run(input autoscale.AlgorithmInput, startTime time.Time) (au
 		}
 	}
 	var outQueue []autoscale.AlgorithmJob
-	for _, m := range queueMap {
-		for _, j := range m {
+	for _, key := range autoscale.SortedTags(queueMap) {
+		for _, j := range queueMap[key] {
 			outQueue = append(outQueue, j)
 		}
 	}
 
-	for _, cloud := range input.Clouds {
+	for _, key := range input.Clouds.Names() {
+		cloud := input.Clouds[key]
 		instances, err := cloud.GetInstances()
 		if err != nil {
 			return out, err
 		}
-		for len(instances) > 1 {
-			index := 0
-			for _, instance := range instances {
-				if instance.State == autoscale.INACTIVE {
-					break
-				}
-				index++
-			}
-			if index < len(instances) && instances[index].State == autoscale.INACTIVE {
-				cloud.DeleteInstance(instances[index].Id, startTime)
-				instances, err = cloud.GetInstances()
-				if err != nil {
-					return out, err
-				}
-			} else if index == len(instances) {
-				break
+		minInstances := b.Options.MinInstances
+		if minInstances < 1 {
+			minInstances = 1
+		}
+		//Delete idle instances until MinInstances are left
+		remaining := make([]autoscale.Instance, 0, len(instances))
+		deleted := 0
+		for _, instance := range instances {
+			if instance.State == autoscale.IDLE && len(instances)-deleted > minInstances {
+				deleted++
+				out.Actions = append(out.Actions, autoscale.ScalingAction{
+					Type:         autoscale.DELETE,
+					Cloud:        key,
+					InstanceType: instance.Type,
+					InstanceId:   instance.Id,
+					Reason:       "keep the minimum number of instances",
+				})
+				continue
 			}
+			remaining = append(remaining, instance)
 		}
-		instances, err = cloud.GetInstances()
-		if len(instances) == 1 && instances[0].State == autoscale.INACTIVE {
-			cloud.AddInstance(&instances[0], startTime)
+		if len(remaining) == 1 && remaining[0].State == autoscale.IDLE {
+			out.Actions = append(out.Actions, autoscale.ScalingAction{
+				Type:         autoscale.REUSE,
+				Cloud:        key,
+				InstanceType: remaining[0].Type,
+				InstanceId:   remaining[0].Id,
+				Reason:       "reuse the last instance",
+			})
 		}
-		if len(instances) == 0 {
-
+		if len(remaining) < minInstances {
 			types, err := cloud.GetInstanceTypes()
 			if err != nil {
 				return out, err
 			}
-			iType := types["default"]
-			i := autoscale.Instance{
-				Id:    "",
-				Type:  iType.Name,
-				State: "",
+			iType := types[instanceTypeName(b.Options.InstanceType)]
+			for k := len(remaining); k < minInstances; k++ {
+				out.Actions = append(out.Actions, autoscale.ScalingAction{
+					Type:         autoscale.CREATE,
+					Cloud:        key,
+					InstanceType: iType.Name,
+					Reason:       "cloud has fewer than the minimum number of instances",
+				})
 			}
-			cloud.AddInstance(&i, startTime)
-			out.Instances = append(out.Instances, i)
 		}
 	}
 	out.JobQueue = outQueue
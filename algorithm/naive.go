@@ -7,12 +7,18 @@ import (
 	"math"
 )
 
+type NaiveOptions struct {
+	// InstanceType is the type of the instances created by the algorithm, "default" if empty
+	InstanceType string `json:"instance_type"`
+}
+
 type NaiveAlgorithm struct {
+	Options NaiveOptions
 }
 
 func (n NaiveAlgorithm) Run(input autoscale.AlgorithmInput, startTime time.Time) (autoscale.AlgorithmOutput, error) {
 	queueMap := make(map[string][]autoscale.AlgorithmJob)
-	var outInstances []autoscale.Instance
+	var actions []autoscale.ScalingAction
 	out := autoscale.AlgorithmOutput{}
 	emptyTagJobs := make([]autoscale.AlgorithmJob, 0)
 	for _, j := range input.JobQueue {
@@ -29,7 +35,8 @@ func (n NaiveAlgorithm) Run(input autoscale.AlgorithmInput, startTime time.Time)
 		shortestCloud := ""
 		var shortest int64
 		shortest = math.MaxInt64
-		for key, cloud := range input.Clouds {
+		for _, key := range input.Clouds.Names() {
+			cloud := input.Clouds[key]
 			if queue, ok := queueMap[key]; ok {
 				cost := cloud.GetTotalCost(queue, startTime)
 				duration, err := cloud.GetTotalDuration(queue, startTime)
@@ -73,8 +80,12 @@ func (n NaiveAlgorithm) Run(input autoscale.AlgorithmInput, startTime time.Time)
 		}
 	}
 
-	for key, queue := range queueMap {
-		curClust := input.Clouds[key]
+	for _, key := range autoscale.SortedTags(queueMap) {
+		queue := queueMap[key]
+		curClust, ok := input.Clouds[key]
+		if !ok {
+			continue
+		}
 		instances, err := curClust.GetInstances()
 		if err != nil {
 			return out, err
@@ -102,111 +113,92 @@ func (n NaiveAlgorithm) Run(input autoscale.AlgorithmInput, startTime time.Time)
 			return false
 		})
 
-		runningJobs := 0
-		activeInstances := 0
+		types, err := curClust.GetInstanceTypes()
+		if err != nil {
+			return autoscale.AlgorithmOutput{}, err
+		}
+		iType := types[instanceTypeName(n.Options.InstanceType)]
+
+		//Idle and booting instances can be reused once each, new instances are only created when there are none left
+		var inactive []autoscale.Instance
 		for _, i := range instances {
-			if i.State == autoscale.ACTIVE {
-				activeInstances++
+			if i.State == autoscale.IDLE || i.State == autoscale.BOOTING || i.State == autoscale.REQUESTED {
+				inactive = append(inactive, i)
 			}
 		}
-
-		sort.Slice(instances, func(i, j int) bool {
-			return instances[i].State == "ACTIVE"
-		})
+		plannedInstances := len(instances)
 
 		for _, job := range queue {
 			if job.State == autoscale.RUNNING {
-				runningJobs++
 				continue
 			}
-			instances, err = curClust.GetInstances()
-			if err != nil {
-				return autoscale.AlgorithmOutput{}, err
+			if len(inactive) > 0 {
+				actions = append(actions, autoscale.ScalingAction{
+					Type:         autoscale.REUSE,
+					Cloud:        key,
+					InstanceType: inactive[0].Type,
+					InstanceId:   inactive[0].Id,
+					Reason:       "reuse idle instance for job " + job.Id,
+				})
+				inactive = inactive[1:]
+			} else if curClust.GetInstanceLimit() > plannedInstances {
+				//Check if there are room to add more cluster
+				actions = append(actions, autoscale.ScalingAction{
+					Type:         autoscale.CREATE,
+					Cloud:        key,
+					InstanceType: iType.Name,
+					Reason:       "no idle instance available for job " + job.Id,
+				})
+				plannedInstances++
 			}
-			//Check if there are room to add more cluster
-			if curClust.GetInstanceLimit() > len(instances) {
-				types, err := curClust.GetInstanceTypes()
-				if err != nil {
-					return autoscale.AlgorithmOutput{}, err
-				}
-				iType := types["default"]
-				instance := autoscale.Instance{
-					Id:    "",
-					Type:  iType.Name,
-					State: "",
-				}
-
-				for k := activeInstances; k < len(instances); k++ {
-					if instances[k].State == "INACTIVE" {
-						instance = instances[k]
-						activeInstances++
-						break
-					}
-				}
+		}
+		queueMap[key] = queue
+	}
 
-				_, err = curClust.AddInstance(&instance, startTime)
-				if err != nil {
-					return autoscale.AlgorithmOutput{}, err
-				}
-				outInstances = append(outInstances, instance)
-			} else {
-				//If all instances have been used, check for inactive instances and use them instead
-				for k := activeInstances-1; k < len(instances); k++ {
-					if instances[k].State == "INACTIVE" {
-						_, err = curClust.AddInstance(&instances[k], startTime)
-						activeInstances++
-						break
-					}
-				}
+	//DELETE the idle instances of clouds without any queued jobs
+	if len(queueMap) > 0 {
+		for _, key := range input.Clouds.Names() {
+			cloud := input.Clouds[key]
+			if _, ok := queueMap[key]; ok {
+				continue
 			}
-		}
-		//DELETE instances based on the queue size, if the instance size is larger than queue,
-		//there should be at least one INACTIVE instance
-		//if len(instances) > (len(queue)) {
-		//	for _, i := range instances {
-		//		if i.State == autoscale.INACTIVE {
-		//			err = curClust.DeleteInstance(i.Id, startTime)
-		//			if err != nil {
-		//				return autoscale.AlgorithmOutput{}, err
-		//			}
-		//			outInstances = append(outInstances, i)
-		//		}
-		//	}
-		//}
-
-		for key, _ := range input.Clouds {
-			if _, ok := queueMap[key]; !ok {
-				instances, err := input.Clouds[key].GetInstances()
-				if err != nil {
-					return autoscale.AlgorithmOutput{}, err
-				}
-				if len(instances) > (len(queue)) {
-					for _, inst := range instances {
-						if inst.State == autoscale.INACTIVE {
-							err := input.Clouds[key].DeleteInstance(inst.Id, startTime)
-							if err != nil {
-								return autoscale.AlgorithmOutput{}, err
-							}
-						}
-					}
+			instances, err := cloud.GetInstances()
+			if err != nil {
+				return autoscale.AlgorithmOutput{}, err
+			}
+			for _, inst := range instances {
+				if inst.State == autoscale.IDLE {
+					actions = append(actions, autoscale.ScalingAction{
+						Type:         autoscale.DELETE,
+						Cloud:        key,
+						InstanceType: inst.Type,
+						InstanceId:   inst.Id,
+						Reason:       "no queued jobs for cloud",
+					})
 				}
 			}
 		}
-		queueMap[key] = queue
 	}
 
 	var outQueue []autoscale.AlgorithmJob
 
-	for _, m := range queueMap {
-		for _, j := range m {
+	for _, key := range autoscale.SortedTags(queueMap) {
+		for _, j := range queueMap[key] {
 			outQueue = append(outQueue, j)
 		}
 	}
 
 	out = autoscale.AlgorithmOutput{
-		Instances: outInstances,
-		JobQueue:  outQueue,
+		Actions:  actions,
+		JobQueue: outQueue,
 	}
 
 	return out, nil
 }
+
+func instanceTypeName(name string) string {
+	if name == "" {
+		return "default"
+	}
+	return name
+}
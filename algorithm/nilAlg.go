@@ -10,8 +10,8 @@ type NilAlg struct {
 
 func (NilAlg) Run(input autoscale.AlgorithmInput, stepTime time.Time) (autoscale.AlgorithmOutput, error) {
 	o := autoscale.AlgorithmOutput{
-		Instances: nil,
-		JobQueue:  input.JobQueue,
+		Actions:  nil,
+		JobQueue: input.JobQueue,
 	}
 	return o, nil
 }
@@ -0,0 +1,64 @@
+package algorithm
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/tteige/uit-go/autoscale"
+	"sort"
+)
+
+// Constructor creates an algorithm from its JSON encoded options, empty options gives the default algorithm
+type Constructor func(options json.RawMessage) (autoscale.Algorithm, error)
+
+var registry = make(map[string]Constructor)
+
+func init() {
+	Register("naive", func(options json.RawMessage) (autoscale.Algorithm, error) {
+		alg := NaiveAlgorithm{}
+		err := autoscale.DecodeOptions(options, &alg.Options)
+		return alg, err
+	})
+	Register("bad", func(options json.RawMessage) (autoscale.Algorithm, error) {
+		alg := BadAlgorithm{
+			Options: BadOptions{
+				MinInstances: 1,
+			},
+		}
+		err := autoscale.DecodeOptions(options, &alg.Options)
+		return alg, err
+	})
+	Register("nil", func(options json.RawMessage) (autoscale.Algorithm, error) {
+		//The nil algorithm has no options
+		err := autoscale.DecodeOptions(options, &struct{}{})
+		return NilAlg{}, err
+	})
+}
+
+// Register makes an algorithm available by name, registering the same name twice replaces the first constructor
+func Register(name string, constructor Constructor) {
+	registry[name] = constructor
+}
+
+// New creates the algorithm registered with the name
+func New(name string, options json.RawMessage) (autoscale.Algorithm, error) {
+	constructor, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown algorithm %q, available algorithms are %v", name, Names())
+	}
+	return constructor(options)
+}
+
+// FromSpec creates the algorithm described by the spec
+func FromSpec(spec autoscale.AlgorithmSpec) (autoscale.Algorithm, error) {
+	return New(spec.Name, spec.Options)
+}
+
+// Names returns the registered algorithm names in sorted order
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
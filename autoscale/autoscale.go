@@ -1,16 +1,40 @@
 package autoscale
 
 import (
+	"bytes"
+	"encoding/json"
+	"sort"
 	"time"
 )
 
 const (
+	QUEUED = "QUEUED"
 	RUNNING = "RUNNING"
 	FINISHED = "FINISHED"
+	// ACTIVE and INACTIVE are the legacy instance states, they are read as BUSY and IDLE
 	ACTIVE = "ACTIVE"
 	INACTIVE = "INACTIVE"
 )
 
+// Instance lifecycle states
+// REQUESTED -> BOOTING -> IDLE <-> BUSY -> DRAINING -> TERMINATED
+const (
+	REQUESTED  = "REQUESTED"
+	BOOTING    = "BOOTING"
+	IDLE       = "IDLE"
+	BUSY       = "BUSY"
+	DRAINING   = "DRAINING"
+	TERMINATED = "TERMINATED"
+)
+
+// Scaling action types, see ScalingAction
+const (
+	CREATE = "CREATE"
+	REUSE  = "REUSE"
+	DELETE = "DELETE"
+	DRAIN  = "DRAIN"
+)
+
 type ClusterCollection map[string]Cluster
 type CloudCollection map[string]Cloud
 type JobParameters map[string]string
@@ -19,6 +43,21 @@ type Instance struct {
 	Id    string `json:"id"`
 	Type  string `json:"type"`
 	State string `json:"state"`
+	// ReadyAt is when a BOOTING instance becomes IDLE
+	ReadyAt time.Time `json:"ready_at"`
+	// TerminateAt is when a DRAINING instance is TERMINATED, zero while it still runs a job
+	TerminateAt time.Time `json:"terminate_at"`
+}
+
+// NormalizeState converts the legacy instance states to the lifecycle states
+func NormalizeState(state string) string {
+	switch state {
+	case ACTIVE, RUNNING:
+		return BUSY
+	case INACTIVE, "":
+		return IDLE
+	}
+	return state
 }
 
 type ScalingEvent struct {
@@ -27,9 +66,68 @@ type ScalingEvent struct {
 	ClusterTag string
 }
 
+// ScalingAction is a single decision made by an Algorithm. The actions are not applied
+// by the algorithm itself, they are executed in order by ApplyActions
+type ScalingAction struct {
+	Type         string `json:"type"`
+	Cloud        string `json:"cloud"`
+	InstanceType string `json:"instance_type"`
+	InstanceId   string `json:"instance_id"`
+	Reason       string `json:"reason"`
+}
+
 type InstanceType struct {
 	Name           string  `json:"name"`
 	PriceIncrement float64 `json:"price"`
+	// BootTime and ShutdownTime are given in seconds
+	BootTime     int64 `json:"boot_time"`
+	ShutdownTime int64 `json:"shutdown_time"`
+	// Billing is how the cloud bills the time an instance of the type is up, per second if it is not set
+	Billing BillingModel `json:"billing"`
+	// Market is OnDemandMarket if empty, SpotMarket or PreemptibleMarket
+	Market string `json:"market,omitempty"`
+	// PriceTrace is a CSV file the Prices are read from when the simulation starts
+	PriceTrace string `json:"price_trace,omitempty"`
+	// Prices are the price changes of the type, the schedule or PriceIncrement is the price before the first of them
+	Prices []PricePoint `json:"prices,omitempty"`
+	// Schedule is the price of the type over time, PriceIncrement is the price before it starts
+	Schedule *PriceSchedule `json:"schedule,omitempty"`
+	// Interruptions is how instances of a spot or preemptible type are interrupted
+	Interruptions *InterruptionModel `json:"interruptions,omitempty"`
+}
+
+// BillingModel bills every started Granularity seconds of an instance in full, 3600 bills per started hour.
+// An instance is billed for at least MinimumCharge seconds. Both are in seconds, and time is billed per second
+// if the granularity is zero
+type BillingModel struct {
+	Granularity   int64 `json:"granularity"`
+	MinimumCharge int64 `json:"minimum_charge"`
+}
+
+// BilledDuration is the time an instance that was up for d is billed for
+func (b BillingModel) BilledDuration(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	if min := time.Duration(b.MinimumCharge) * time.Second; d < min {
+		d = min
+	}
+	step := time.Duration(b.Granularity) * time.Second
+	if step <= 0 {
+		step = time.Second
+	}
+	if rest := d % step; rest != 0 {
+		d += step - rest
+	}
+	return d
+}
+
+func (t InstanceType) BootDuration() time.Duration {
+	return time.Duration(t.BootTime) * time.Second
+}
+
+func (t InstanceType) ShutdownDuration() time.Duration {
+	return time.Duration(t.ShutdownTime) * time.Second
 }
 
 type Cluster struct {
@@ -38,6 +136,126 @@ type Cluster struct {
 	AcceptTag       string                  `json:"tag"`
 	Types           map[string]InstanceType `json:"types"`
 	ActiveInstances []Instance              `json:"instances"`
+	// Faults makes a simulated cluster fail, the cluster never fails if it is nil
+	Faults *FaultModel `json:"faults,omitempty"`
+}
+
+// FaultModel describes how a simulated cluster loses capacity
+type FaultModel struct {
+	// MTBF is the mean time between failures of a running instance in seconds, instances never crash if zero
+	MTBF float64 `json:"mtbf"`
+	// BootFailure is the probability that a booting instance fails instead of becoming IDLE
+	BootFailure float64 `json:"boot_failure"`
+	// Outages are the periods where the whole cloud is down. Every instance is lost when an outage starts
+	// and no instances can be created until it ends
+	Outages []Outage `json:"outages"`
+}
+
+type Outage struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Copy returns a deep copy of the cluster, changes to the instances or types of the copy do not affect the original
+func (c Cluster) Copy() Cluster {
+	if c.Types != nil {
+		types := make(map[string]InstanceType, len(c.Types))
+		for name, t := range c.Types {
+			t.Prices = append([]PricePoint(nil), t.Prices...)
+			if t.Interruptions != nil {
+				interruptions := *t.Interruptions
+				t.Interruptions = &interruptions
+			}
+			if t.Schedule != nil {
+				t.Schedule = t.Schedule.Copy()
+			}
+			types[name] = t
+		}
+		c.Types = types
+	}
+	if c.ActiveInstances != nil {
+		c.ActiveInstances = append(make([]Instance, 0, len(c.ActiveInstances)), c.ActiveInstances...)
+	}
+	if c.Faults != nil {
+		faults := *c.Faults
+		faults.Outages = append([]Outage(nil), faults.Outages...)
+		c.Faults = &faults
+	}
+	return c
+}
+
+// Copy returns a deep copy of every cluster in the collection
+func (c ClusterCollection) Copy() ClusterCollection {
+	if c == nil {
+		return nil
+	}
+	clusters := make(ClusterCollection, len(c))
+	for name, cluster := range c {
+		clusters[name] = cluster.Copy()
+	}
+	return clusters
+}
+
+// Names returns the names of the clouds in sorted order. Ranging over the map visits the clouds in a random
+// order, simulations iterate the names instead so a run can be reproduced
+func (c CloudCollection) Names() []string {
+	names := make([]string, 0, len(c))
+	for name := range c {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SortedTags returns the tags of a queue split by tag in sorted order
+func SortedTags(queues map[string][]AlgorithmJob) []string {
+	tags := make([]string, 0, len(queues))
+	for tag := range queues {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// Noise models of the actual execution time of a job
+const (
+	NormalNoise    = "normal"
+	LognormalNoise = "lognormal"
+	EmpiricalNoise = "empirical"
+)
+
+// NoiseSpec describes how the actual execution time of a job varies around its estimate.
+// The actual execution time is the estimate multiplied by a random factor with mean 1
+type NoiseSpec struct {
+	// Model is "normal", "lognormal" or "empirical"
+	Model string `json:"model"`
+	// Sigma is the standard deviation of the factor for normal noise and of its logarithm for lognormal noise
+	Sigma float64 `json:"sigma"`
+	// Residuals are the factors of the empirical model, the residuals of the estimator are used if empty
+	Residuals []float64 `json:"residuals"`
+}
+
+// AlgorithmSpec selects a registered algorithm by name, the options are decoded by the algorithm
+type AlgorithmSpec struct {
+	Name    string          `json:"name"`
+	Options json.RawMessage `json:"options"`
+}
+
+// EstimatorSpec selects a registered estimator by name, the options are decoded by the estimator
+type EstimatorSpec struct {
+	Name    string          `json:"name"`
+	Options json.RawMessage `json:"options"`
+}
+
+// DecodeOptions decodes JSON encoded options into out, unknown fields are rejected.
+// Empty or null options leave out unchanged
+func DecodeOptions(options json.RawMessage, out interface{}) error {
+	if len(options) == 0 || string(options) == "null" {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(options))
+	dec.DisallowUnknownFields()
+	return dec.Decode(out)
 }
 
 type AlgorithmInput struct {
@@ -46,6 +264,7 @@ type AlgorithmInput struct {
 }
 
 type AlgorithmOutput struct {
+	Actions   []ScalingAction
 	Instances []Instance
 	JobQueue  []AlgorithmJob
 }
@@ -61,6 +280,14 @@ type AlgorithmJob struct {
 	Created         time.Time
 	Started         time.Time
 	InstanceFlavour string
+	// Processors and Memory are the resources requested by the job, Memory in kilobytes per processor.
+	// Both are zero if they are not known
+	Processors int
+	Memory     int64
+	// Attempts counts the times the job was started and lost because its instance crashed
+	Attempts int
+	// InstanceId is the instance the job was started on, empty if it is not known
+	InstanceId string
 }
 
 type Algorithm interface {
@@ -72,12 +299,19 @@ type Estimator interface {
 	ProcessQueue(jobs []AlgorithmJob) ([]AlgorithmJob, error)
 }
 
+// ResidualSource is implemented by estimators that know how far off their estimates are. The residuals of a tag are
+// the actual execution times of the training jobs divided by their estimates
+type ResidualSource interface {
+	Residuals(tag string) []float64
+}
+
 type Cloud interface {
 	Authenticate() error
 	SetScalingId(id string) error
 	GetExpectedJobCost(job AlgorithmJob, instanceType string, currentTime time.Time) float64
 	AddInstance(instance *Instance, currentTime time.Time) (string, error)
 	DeleteInstance(id string, currentTime time.Time) error
+	DrainInstance(id string, currentTime time.Time) error
 	GetInstances() ([]Instance, error)
 	GetInstanceTypes() (map[string]InstanceType, error)
 	GetInstanceLimit() int
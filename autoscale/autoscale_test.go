@@ -0,0 +1,30 @@
+package autoscale
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBilledDuration(t *testing.T) {
+	tests := []struct {
+		name  string
+		model BillingModel
+		up    time.Duration
+		want  time.Duration
+	}{
+		{"per second", BillingModel{}, 90*time.Second + 300*time.Millisecond, 91 * time.Second},
+		{"per second exact", BillingModel{}, 90 * time.Second, 90 * time.Second},
+		{"never up", BillingModel{Granularity: 3600, MinimumCharge: 60}, 0, 0},
+		{"started hour", BillingModel{Granularity: 3600}, 61 * time.Minute, 2 * time.Hour},
+		{"full hour", BillingModel{Granularity: 3600}, time.Hour, time.Hour},
+		{"minimum charge", BillingModel{MinimumCharge: 60}, 10 * time.Second, time.Minute},
+		{"above minimum charge", BillingModel{MinimumCharge: 60}, 70 * time.Second, 70 * time.Second},
+		{"minimum charge rounded up", BillingModel{Granularity: 3600, MinimumCharge: 60}, 10 * time.Second, time.Hour},
+	}
+	for _, test := range tests {
+		got := test.model.BilledDuration(test.up)
+		if got != test.want {
+			t.Errorf("%s: BilledDuration(%v) = %v, want %v", test.name, test.up, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package autoscale
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Dispatcher decides which waiting jobs of a cloud start on its free instances. A job can only start on an
+// instance of its flavour, or on any instance if it has none
+type Dispatcher interface {
+	Dispatch(input DispatchInput) []Placement
+}
+
+// DispatchInput is the state of a cloud when jobs can be started. Waiting are the queued jobs of the cloud,
+// Running the jobs running on it and Free the instances that can take a job. Instances are all the instances of
+// the cloud, they give the type of the instances of the running jobs
+type DispatchInput struct {
+	Waiting   []AlgorithmJob
+	Running   []AlgorithmJob
+	Free      []Instance
+	Instances []Instance
+	Now       time.Time
+}
+
+// Placement starts the waiting job Job on the free instance Instance, both are indexes into the DispatchInput
+type Placement struct {
+	Job      int
+	Instance int
+}
+
+// Dispatchers by name, PriorityDispatch is used when none is selected
+const (
+	FIFODispatch     = "fifo"
+	PriorityDispatch = "priority"
+	EDFDispatch      = "edf"
+)
+
+// NewDispatcher creates the dispatcher with the name, the priority dispatcher if the name is empty
+func NewDispatcher(name string) (Dispatcher, error) {
+	switch name {
+	case FIFODispatch:
+		return orderedDispatcher{less: arrivedFirst}, nil
+	case PriorityDispatch, "":
+		return orderedDispatcher{less: priorityFirst}, nil
+	case EDFDispatch:
+		return orderedDispatcher{less: deadlineFirst}, nil
+	}
+	return nil, fmt.Errorf("unknown dispatcher %q, available dispatchers are %v", name, DispatcherNames())
+}
+
+// DispatcherNames returns the dispatcher names in sorted order
+func DispatcherNames() []string {
+	return []string{EDFDispatch, FIFODispatch, PriorityDispatch}
+}
+
+// orderedDispatcher starts the waiting jobs in the order of less until a job can not start, the jobs behind it
+// wait even if there is a free instance for them. Every job runs on a single instance
+type orderedDispatcher struct {
+	less func(a, b AlgorithmJob) bool
+}
+
+func (d orderedDispatcher) Dispatch(input DispatchInput) []Placement {
+	used := make([]bool, len(input.Free))
+	var placements []Placement
+	for _, job := range sortedJobs(input.Waiting, d.less) {
+		instance := freeInstance(input.Free, used, input.Waiting[job])
+		if instance < 0 {
+			break
+		}
+		used[instance] = true
+		placements = append(placements, Placement{Job: job, Instance: instance})
+	}
+	return placements
+}
+
+func fits(job AlgorithmJob, instanceType string) bool {
+	return job.InstanceFlavour == "" || job.InstanceFlavour == instanceType
+}
+
+// freeInstance is the first free instance that is not used and fits the job, -1 if there is none
+func freeInstance(free []Instance, used []bool, job AlgorithmJob) int {
+	for i, instance := range free {
+		if !used[i] && fits(job, instance.Type) {
+			return i
+		}
+	}
+	return -1
+}
+
+// sortedJobs returns the indexes of the jobs stable sorted by less
+func sortedJobs(jobs []AlgorithmJob, less func(a, b AlgorithmJob) bool) []int {
+	order := make([]int, len(jobs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return less(jobs[order[a]], jobs[order[b]])
+	})
+	return order
+}
+
+func arrivedFirst(a, b AlgorithmJob) bool {
+	return a.Created.Before(b.Created)
+}
+
+// priorityFirst orders the jobs by priority, a lower value runs first
+func priorityFirst(a, b AlgorithmJob) bool {
+	return a.Priority < b.Priority
+}
+
+// deadlineFirst orders the jobs by deadline, jobs without a deadline come last in priority order
+func deadlineFirst(a, b AlgorithmJob) bool {
+	if a.Deadline.IsZero() || b.Deadline.IsZero() {
+		if a.Deadline.IsZero() && b.Deadline.IsZero() {
+			return priorityFirst(a, b)
+		}
+		return b.Deadline.IsZero()
+	}
+	return a.Deadline.Before(b.Deadline)
+}
@@ -0,0 +1,94 @@
+package autoscale
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDispatch(t *testing.T) {
+	start := time.Date(2017, 11, 24, 0, 0, 0, 0, time.UTC)
+	job := func(id string, minute int, priority int, flavour string, deadline int) AlgorithmJob {
+		j := AlgorithmJob{
+			Id:              id,
+			State:           QUEUED,
+			Created:         start.Add(time.Duration(minute) * time.Minute),
+			Priority:        priority,
+			InstanceFlavour: flavour,
+		}
+		if deadline > 0 {
+			j.Deadline = start.Add(time.Duration(deadline) * time.Minute)
+		}
+		return j
+	}
+	waiting := []AlgorithmJob{
+		job("a", 0, 5, "large", 0),
+		job("b", 1, 1, "", 90),
+		job("c", 2, 3, "", 30),
+		job("d", 3, 2, "", 0),
+	}
+	free := []Instance{
+		{Id: "i1", Type: "small", State: IDLE},
+		{Id: "i2", Type: "small", State: IDLE},
+	}
+	tests := []struct {
+		dispatcher string
+		waiting    []AlgorithmJob
+		free       []Instance
+		want       []Placement
+	}{
+		//The first job needs a large instance, so nothing starts
+		{FIFODispatch, waiting, free, nil},
+		{PriorityDispatch, waiting, free, []Placement{{Job: 1, Instance: 0}, {Job: 3, Instance: 1}}},
+		{EDFDispatch, waiting, free, []Placement{{Job: 2, Instance: 0}, {Job: 1, Instance: 1}}},
+		{FIFODispatch, waiting[1:], free, []Placement{{Job: 0, Instance: 0}, {Job: 1, Instance: 1}}},
+		{FIFODispatch, waiting, append([]Instance{{Id: "i0", Type: "large", State: IDLE}}, free...),
+			[]Placement{{Job: 0, Instance: 0}, {Job: 1, Instance: 1}, {Job: 2, Instance: 2}}},
+		{FIFODispatch, waiting, nil, nil},
+		{PriorityDispatch, nil, free, nil},
+	}
+	for i, test := range tests {
+		d, err := NewDispatcher(test.dispatcher)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := d.Dispatch(DispatchInput{Waiting: test.waiting, Free: test.free, Instances: test.free, Now: start})
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%d %s: got %v, want %v", i, test.dispatcher, got, test.want)
+		}
+	}
+}
+
+func TestNewDispatcher(t *testing.T) {
+	for _, name := range append(DispatcherNames(), "") {
+		if _, err := NewDispatcher(name); err != nil {
+			t.Errorf("NewDispatcher(%q): %s", name, err)
+		}
+	}
+	if _, err := NewDispatcher("lifo"); err == nil {
+		t.Error("NewDispatcher(\"lifo\") gave no error")
+	}
+}
+
+func TestDeadlineFirst(t *testing.T) {
+	start := time.Date(2017, 11, 24, 0, 0, 0, 0, time.UTC)
+	early := AlgorithmJob{Deadline: start, Priority: 9}
+	late := AlgorithmJob{Deadline: start.Add(time.Hour), Priority: 1}
+	none := AlgorithmJob{Priority: 0}
+	tests := []struct {
+		a, b AlgorithmJob
+		want bool
+	}{
+		{early, late, true},
+		{late, early, false},
+		{late, none, true},
+		{none, late, false},
+		{none, AlgorithmJob{Priority: 1}, true},
+		{AlgorithmJob{Priority: 1}, none, false},
+	}
+	for i, test := range tests {
+		if got := deadlineFirst(test.a, test.b); got != test.want {
+			t.Errorf("%d: deadlineFirst = %v, want %v", i, got, test.want)
+		}
+	}
+}
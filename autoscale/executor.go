@@ -0,0 +1,78 @@
+package autoscale
+
+import (
+	"fmt"
+	"time"
+)
+
+// ApplyActions executes the scaling actions in order on the clouds in the collection.
+// The returned instances are the instances affected by the actions, in the same order as the actions.
+// Execution stops at the first action that fails.
+func ApplyActions(clouds CloudCollection, actions []ScalingAction, currentTime time.Time) ([]Instance, error) {
+	var applied []Instance
+	for _, action := range actions {
+		cloud, ok := clouds[action.Cloud]
+		if !ok {
+			return applied, fmt.Errorf("scaling action %s refers to unknown cloud %q", action.Type, action.Cloud)
+		}
+		switch action.Type {
+		case CREATE:
+			instance := Instance{
+				Id:    "",
+				Type:  action.InstanceType,
+				State: "",
+			}
+			_, err := cloud.AddInstance(&instance, currentTime)
+			if err != nil {
+				return applied, err
+			}
+			applied = append(applied, instance)
+		case REUSE:
+			instance, err := findInstance(cloud, action.InstanceId)
+			if err != nil {
+				return applied, err
+			}
+			_, err = cloud.AddInstance(&instance, currentTime)
+			if err != nil {
+				return applied, err
+			}
+			applied = append(applied, instance)
+		case DELETE:
+			instance, err := findInstance(cloud, action.InstanceId)
+			if err != nil {
+				return applied, err
+			}
+			err = cloud.DeleteInstance(instance.Id, currentTime)
+			if err != nil {
+				return applied, err
+			}
+			applied = append(applied, instance)
+		case DRAIN:
+			instance, err := findInstance(cloud, action.InstanceId)
+			if err != nil {
+				return applied, err
+			}
+			err = cloud.DrainInstance(instance.Id, currentTime)
+			if err != nil {
+				return applied, err
+			}
+			applied = append(applied, instance)
+		default:
+			return applied, fmt.Errorf("unknown scaling action type %q", action.Type)
+		}
+	}
+	return applied, nil
+}
+
+func findInstance(cloud Cloud, id string) (Instance, error) {
+	instances, err := cloud.GetInstances()
+	if err != nil {
+		return Instance{}, err
+	}
+	for _, i := range instances {
+		if i.Id == id {
+			return i, nil
+		}
+	}
+	return Instance{}, fmt.Errorf("instance %q not found", id)
+}
@@ -0,0 +1,145 @@
+package autoscale
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The markets an instance type can be bought in. Spot and preemptible instances are cheaper, but the cloud can
+// take them back at any time
+const (
+	OnDemandMarket    = "on-demand"
+	SpotMarket        = "spot"
+	PreemptibleMarket = "preemptible"
+)
+
+// PreemptibleLifetime is how long a preemptible instance runs at most when its interruption model has no lifetime
+const PreemptibleLifetime = 24 * time.Hour
+
+// PricePoint is the price of an instance type from Time until the next price point
+type PricePoint struct {
+	Time  time.Time `json:"time"`
+	Price float64   `json:"price"`
+}
+
+// InterruptionModel describes when the cloud interrupts the running instances of a spot or preemptible type
+type InterruptionModel struct {
+	// PerHour is the probability that a running instance is interrupted within an hour
+	PerHour float64 `json:"per_hour"`
+	// MaxPrice is the most that is paid for an instance, it is interrupted when the price trace goes above it.
+	// Instances are never interrupted by the price if it is zero
+	MaxPrice float64 `json:"max_price"`
+	// Lifetime is how long an instance runs at most in seconds, PreemptibleLifetime for preemptible types if zero
+	Lifetime int64 `json:"lifetime"`
+}
+
+// ValidMarket reports if the market is one of the markets, an empty market is on-demand
+func ValidMarket(market string) bool {
+	switch market {
+	case "", OnDemandMarket, SpotMarket, PreemptibleMarket:
+		return true
+	}
+	return false
+}
+
+// Interruptible reports if the cloud can interrupt the instances of the type
+func (t InstanceType) Interruptible() bool {
+	return t.Market == SpotMarket || t.Market == PreemptibleMarket
+}
+
+// PriceAt is the price of the type at the time: the last price of the price trace at or before it, the price of
+// the schedule before the trace starts, and PriceIncrement before both. The prices must be sorted by time and the
+// schedule validated
+func (t InstanceType) PriceAt(at time.Time) float64 {
+	i := sort.Search(len(t.Prices), func(i int) bool {
+		return t.Prices[i].Time.After(at)
+	})
+	if i > 0 {
+		return t.Prices[i-1].Price
+	}
+	if t.Schedule != nil {
+		if price, ok := t.Schedule.priceAt(at); ok {
+			return price
+		}
+	}
+	return t.PriceIncrement
+}
+
+// Cost is the price of an instance of the type that is up from from until to, integrated over the price changes
+// of the price trace and the schedule in between. An instance that is not up after from costs nothing
+func (t InstanceType) Cost(from time.Time, to time.Time) float64 {
+	if !to.After(from) {
+		return 0
+	}
+	if len(t.Prices) == 0 && t.Schedule == nil {
+		return t.PriceIncrement * to.Sub(from).Hours()
+	}
+	cost := 0.0
+	for at := from; at.Before(to); {
+		until := t.nextPriceChange(at)
+		if until.IsZero() || until.After(to) {
+			until = to
+		}
+		cost += t.PriceAt(at) * until.Sub(at).Hours()
+		at = until
+	}
+	return cost
+}
+
+// nextPriceChange returns the first time after at where the price of the type can change, zero if it never does
+func (t InstanceType) nextPriceChange(at time.Time) time.Time {
+	var next time.Time
+	i := sort.Search(len(t.Prices), func(i int) bool {
+		return t.Prices[i].Time.After(at)
+	})
+	if i < len(t.Prices) {
+		next = t.Prices[i].Time
+	}
+	if t.Schedule != nil {
+		if change := t.Schedule.nextChange(at); !change.IsZero() && (next.IsZero() || change.Before(next)) {
+			next = change
+		}
+	}
+	return next
+}
+
+// ReadPriceTrace reads a CSV price trace with a time in RFC 3339 format and a price on every row. The first row is
+// skipped if it is a header. The price points are returned sorted by time
+func ReadPriceTrace(r io.Reader) ([]PricePoint, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var prices []PricePoint
+	for i, record := range records {
+		at, err := time.Parse(time.RFC3339, strings.TrimSpace(record[0]))
+		if err != nil && i == 0 {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("price trace line %d: %s", i+1, err)
+		}
+		price, err := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("price trace line %d: %s", i+1, err)
+		}
+		prices = append(prices, PricePoint{Time: at, Price: price})
+	}
+	SortPrices(prices)
+	return prices, nil
+}
+
+// SortPrices sorts the price points by time
+func SortPrices(prices []PricePoint) {
+	sort.SliceStable(prices, func(i, j int) bool {
+		return prices[i].Time.Before(prices[j].Time)
+	})
+}
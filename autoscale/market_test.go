@@ -0,0 +1,80 @@
+package autoscale
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPriceAt(t *testing.T) {
+	traced := InstanceType{Name: "default", PriceIncrement: 0.68, Prices: []PricePoint{
+		{Time: time.Date(2017, 11, 24, 6, 0, 0, 0, time.UTC), Price: 2},
+		{Time: time.Date(2017, 11, 24, 12, 0, 0, 0, time.UTC), Price: 4},
+	}}
+	tests := []struct {
+		t    InstanceType
+		at   time.Time
+		want float64
+	}{
+		//Before the first price of the trace the fixed price is used
+		{traced, time.Date(2017, 11, 24, 5, 0, 0, 0, time.UTC), 0.68},
+		{traced, time.Date(2017, 11, 24, 6, 0, 0, 0, time.UTC), 2},
+		{traced, time.Date(2017, 11, 24, 9, 0, 0, 0, time.UTC), 2},
+		{traced, time.Date(2017, 11, 26, 0, 0, 0, 0, time.UTC), 4},
+		{InstanceType{PriceIncrement: 0.48}, time.Date(2017, 11, 24, 0, 0, 0, 0, time.UTC), 0.48},
+	}
+	for i, test := range tests {
+		if got := test.t.PriceAt(test.at); got != test.want {
+			t.Errorf("%d: PriceAt(%v) = %v, want %v", i, test.at, got, test.want)
+		}
+	}
+}
+
+func TestCost(t *testing.T) {
+	traced := InstanceType{PriceIncrement: 1, Prices: []PricePoint{
+		{Time: time.Date(2017, 11, 24, 12, 0, 0, 0, time.UTC), Price: 4},
+	}}
+	hour := func(h int) time.Time {
+		return time.Date(2017, 11, 24, h, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		t        InstanceType
+		from, to time.Time
+		want     float64
+	}{
+		{InstanceType{PriceIncrement: 0.48}, hour(0), hour(10), 4.8},
+		{traced, hour(11), hour(13), 1 + 4},
+		{traced, hour(11), hour(11), 0},
+		{InstanceType{PriceIncrement: 0.48}, hour(10), hour(0), 0},
+		{traced, hour(13), hour(11), 0},
+	}
+	for i, test := range tests {
+		if got := test.t.Cost(test.from, test.to); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("%d: Cost(%v, %v) = %v, want %v", i, test.from, test.to, got, test.want)
+		}
+	}
+}
+
+func TestReadPriceTrace(t *testing.T) {
+	trace := "time,price\n2017-11-24T12:00:00Z, 4\n2017-11-24T06:00:00Z,2.5\n"
+	prices, err := ReadPriceTrace(strings.NewReader(trace))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PricePoint{
+		{Time: time.Date(2017, 11, 24, 6, 0, 0, 0, time.UTC), Price: 2.5},
+		{Time: time.Date(2017, 11, 24, 12, 0, 0, 0, time.UTC), Price: 4},
+	}
+	if len(prices) != len(want) {
+		t.Fatalf("got %d prices, want %d", len(prices), len(want))
+	}
+	for i := range want {
+		if !prices[i].Time.Equal(want[i].Time) || prices[i].Price != want[i].Price {
+			t.Errorf("price %d is %v, want %v", i, prices[i], want[i])
+		}
+	}
+	if _, err := ReadPriceTrace(strings.NewReader("2017-11-24T06:00:00Z,cheap\n")); err == nil {
+		t.Error("a trace with an invalid price was accepted")
+	}
+}
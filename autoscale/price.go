@@ -0,0 +1,189 @@
+package autoscale
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The days a PriceRate can apply to
+const (
+	Weekdays = "weekday"
+	Weekends = "weekend"
+)
+
+// PriceSchedule is the price of an instance type over time. The period in effect at a time is the last one that
+// starts at or before it, and the price is the first of its rates that covers the time, or the price of the period
+// if none does. The times of day and days of the week are in the time zone Location, UTC if it is empty
+type PriceSchedule struct {
+	Location string        `json:"location"`
+	Periods  []PricePeriod `json:"periods"`
+}
+
+// PricePeriod is the price of an instance type from From until the next period starts
+type PricePeriod struct {
+	From  time.Time   `json:"from"`
+	Price float64     `json:"price"`
+	Rates []PriceRate `json:"rates,omitempty"`
+}
+
+// PriceRate is the price during a part of the day on some days of the week. Days is Weekdays, Weekends or empty
+// for every day. Start and End are times of day like "08:00", the rate covers the whole day if both are empty and
+// runs over midnight if End is not after Start. The day of a time is the day it falls on
+type PriceRate struct {
+	Days  string  `json:"days"`
+	Start string  `json:"start"`
+	End   string  `json:"end"`
+	Price float64 `json:"price"`
+}
+
+// Validate checks the time zone, days and times of day of the schedule and sorts its periods by start
+func (s *PriceSchedule) Validate() error {
+	if _, err := location(s.Location); err != nil {
+		return err
+	}
+	for _, p := range s.Periods {
+		for _, r := range p.Rates {
+			if r.Days != "" && r.Days != Weekdays && r.Days != Weekends {
+				return fmt.Errorf("unknown days %q of a price rate, the days are %q or %q", r.Days, Weekdays, Weekends)
+			}
+			if _, _, err := r.clock(); err != nil {
+				return err
+			}
+		}
+	}
+	sort.SliceStable(s.Periods, func(i, j int) bool {
+		return s.Periods[i].From.Before(s.Periods[j].From)
+	})
+	return nil
+}
+
+// Copy returns a deep copy of the schedule
+func (s *PriceSchedule) Copy() *PriceSchedule {
+	c := &PriceSchedule{Location: s.Location}
+	for _, p := range s.Periods {
+		p.Rates = append([]PriceRate(nil), p.Rates...)
+		c.Periods = append(c.Periods, p)
+	}
+	return c
+}
+
+// priceAt returns the price of the schedule at the time, false if it is before the first period
+func (s *PriceSchedule) priceAt(at time.Time) (float64, bool) {
+	i := sort.Search(len(s.Periods), func(i int) bool {
+		return s.Periods[i].From.After(at)
+	})
+	if i == 0 {
+		return 0, false
+	}
+	period := s.Periods[i-1]
+	loc, _ := location(s.Location)
+	local := at.In(loc)
+	for _, r := range period.Rates {
+		if r.covers(local) {
+			return r.Price, true
+		}
+	}
+	return period.Price, true
+}
+
+// nextChange returns the first time after at where the price of the schedule can change, zero if it never does
+func (s *PriceSchedule) nextChange(at time.Time) time.Time {
+	var next time.Time
+	earliest := func(candidate time.Time) {
+		if next.IsZero() || candidate.Before(next) {
+			next = candidate
+		}
+	}
+	i := sort.Search(len(s.Periods), func(i int) bool {
+		return s.Periods[i].From.After(at)
+	})
+	if i < len(s.Periods) {
+		earliest(s.Periods[i].From)
+	}
+	if i == 0 || len(s.Periods[i-1].Rates) == 0 {
+		return next
+	}
+	//The rates change at their times of day and the days they apply to change at midnight
+	loc, _ := location(s.Location)
+	earliest(nextClock(at, 0, loc))
+	for _, r := range s.Periods[i-1].Rates {
+		start, end, _ := r.clock()
+		if start >= 0 {
+			earliest(nextClock(at, start, loc))
+			earliest(nextClock(at, end, loc))
+		}
+	}
+	return next
+}
+
+// clock returns the start and end of the rate in minutes after midnight, -1 for both if it covers the whole day
+func (r PriceRate) clock() (int, int, error) {
+	if r.Start == "" && r.End == "" {
+		return -1, -1, nil
+	}
+	start, err := clockMinutes(r.Start)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := clockMinutes(r.End)
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+func (r PriceRate) covers(local time.Time) bool {
+	weekend := local.Weekday() == time.Saturday || local.Weekday() == time.Sunday
+	if (r.Days == Weekdays && weekend) || (r.Days == Weekends && !weekend) {
+		return false
+	}
+	start, end, _ := r.clock()
+	if start < 0 {
+		return true
+	}
+	minute := local.Hour()*60 + local.Minute()
+	if start < end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+func clockMinutes(clock string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(clock))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q of a price rate, it must be like 08:00", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// nextClock returns the first time after at where the clock in loc shows minutes after midnight
+func nextClock(at time.Time, minutes int, loc *time.Location) time.Time {
+	local := at.In(loc)
+	next := time.Date(local.Year(), local.Month(), local.Day(), minutes/60, minutes%60, 0, 0, loc)
+	if !next.After(at) {
+		next = time.Date(local.Year(), local.Month(), local.Day()+1, minutes/60, minutes%60, 0, 0, loc)
+	}
+	return next
+}
+
+// The time zones are loaded once, loading reads the time zone database
+var locations sync.Map
+
+// location returns the time zone with the name, UTC with the error if there is no such time zone
+func location(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
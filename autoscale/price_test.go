@@ -0,0 +1,89 @@
+package autoscale
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func testSchedule(t *testing.T) InstanceType {
+	schedule := &PriceSchedule{Periods: []PricePeriod{
+		{From: time.Date(2017, 12, 1, 0, 0, 0, 0, time.UTC), Price: 0.9},
+		{From: time.Date(2017, 11, 24, 0, 0, 0, 0, time.UTC), Price: 0.78, Rates: []PriceRate{
+			{Days: Weekdays, Start: "08:00", End: "20:00", Price: 1.2},
+			{Days: Weekends, Price: 0.5},
+			{Start: "22:00", End: "06:00", Price: 0.3},
+		}},
+	}}
+	if err := schedule.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	return InstanceType{Name: "default", PriceIncrement: 0.68, Schedule: schedule}
+}
+
+func TestSchedulePriceAt(t *testing.T) {
+	scheduled := testSchedule(t)
+	traced := testSchedule(t)
+	traced.Prices = []PricePoint{
+		{Time: time.Date(2017, 11, 24, 6, 0, 0, 0, time.UTC), Price: 2},
+		{Time: time.Date(2017, 11, 24, 12, 0, 0, 0, time.UTC), Price: 4},
+	}
+	tests := []struct {
+		t    InstanceType
+		at   time.Time
+		want float64
+	}{
+		{scheduled, time.Date(2017, 11, 23, 12, 0, 0, 0, time.UTC), 0.68},
+		{scheduled, time.Date(2017, 11, 24, 7, 59, 0, 0, time.UTC), 0.78},
+		{scheduled, time.Date(2017, 11, 24, 8, 0, 0, 0, time.UTC), 1.2},
+		{scheduled, time.Date(2017, 11, 24, 20, 0, 0, 0, time.UTC), 0.78},
+		{scheduled, time.Date(2017, 11, 24, 23, 0, 0, 0, time.UTC), 0.3},
+		{scheduled, time.Date(2017, 11, 24, 5, 0, 0, 0, time.UTC), 0.3},
+		{scheduled, time.Date(2017, 11, 25, 12, 0, 0, 0, time.UTC), 0.5},
+		{scheduled, time.Date(2017, 12, 1, 12, 0, 0, 0, time.UTC), 0.9},
+		//The price trace comes before the schedule
+		{traced, time.Date(2017, 11, 24, 5, 0, 0, 0, time.UTC), 0.3},
+		{traced, time.Date(2017, 11, 24, 9, 0, 0, 0, time.UTC), 2},
+		{traced, time.Date(2017, 11, 26, 0, 0, 0, 0, time.UTC), 4},
+	}
+	for i, test := range tests {
+		if got := test.t.PriceAt(test.at); got != test.want {
+			t.Errorf("%d: PriceAt(%v) = %v, want %v", i, test.at, got, test.want)
+		}
+	}
+}
+
+func TestScheduleCost(t *testing.T) {
+	scheduled := testSchedule(t)
+	day := func(d, h int) time.Time {
+		return time.Date(2017, 11, d, h, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		from, to time.Time
+		want     float64
+	}{
+		{day(24, 7), day(24, 9), 0.78 + 1.2},
+		{day(24, 19), day(25, 1), 1.2 + 2*0.78 + 2*0.3 + 0.5},
+		{day(30, 23), day(31, 1), 0.3 + 0.9},
+		{day(23, 23), day(24, 1), 0.68 + 0.3},
+		{day(24, 9), day(24, 7), 0},
+	}
+	for i, test := range tests {
+		if got := scheduled.Cost(test.from, test.to); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("%d: Cost(%v, %v) = %v, want %v", i, test.from, test.to, got, test.want)
+		}
+	}
+}
+
+func TestValidateSchedule(t *testing.T) {
+	tests := []PriceSchedule{
+		{Location: "Nowhere/Atlantis"},
+		{Periods: []PricePeriod{{Rates: []PriceRate{{Days: "monday"}}}}},
+		{Periods: []PricePeriod{{Rates: []PriceRate{{Start: "8am", End: "20:00"}}}}},
+	}
+	for i, test := range tests {
+		if err := test.Validate(); err == nil {
+			t.Errorf("%d: invalid schedule was accepted", i)
+		}
+	}
+}
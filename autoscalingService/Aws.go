@@ -3,12 +3,12 @@ package autoscalingService
 import (
 	"github.com/tteige/uit-go/autoscale"
 	"time"
-	"database/sql"
+	"github.com/tteige/uit-go/models"
 )
 
 type Aws struct {
 	Cluster autoscale.Cluster
-	DB *sql.DB
+	Store models.Store
 }
 
 func (*Aws) Authenticate() error {
@@ -31,6 +31,10 @@ func (*Aws) DeleteInstance(id string, currentTime time.Time) error {
 	panic("implement me")
 }
 
+func (*Aws) DrainInstance(id string, currentTime time.Time) error {
+	panic("implement me")
+}
+
 func (*Aws) GetInstances() ([]autoscale.Instance, error) {
 	panic("implement me")
 }
@@ -3,12 +3,12 @@ package autoscalingService
 import (
 	"github.com/tteige/uit-go/autoscale"
 	"time"
-	"database/sql"
+	"github.com/tteige/uit-go/models"
 )
 
 type Stallo struct {
 	Cluster autoscale.Cluster
-	DB *sql.DB
+	Store models.Store
 }
 
 func (*Stallo) Authenticate() error {
@@ -31,6 +31,10 @@ func (*Stallo) DeleteInstance(id string, currentTime time.Time) error {
 	panic("implement me")
 }
 
+func (*Stallo) DrainInstance(id string, currentTime time.Time) error {
+	panic("implement me")
+}
+
 func (*Stallo) GetInstances() ([]autoscale.Instance, error) {
 	panic("implement me")
 }
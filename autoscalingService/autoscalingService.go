@@ -29,12 +29,13 @@ type prevRun struct {
 }
 
 type Service struct {
-	DB        *sql.DB
-	Hostname  string
-	Clouds    autoscale.CloudCollection
-	Algorithm autoscale.Algorithm
-	Log       *log.Logger
-	Estimator autoscale.Estimator
+	Store         models.Store
+	Hostname      string
+	Clouds        autoscale.CloudCollection
+	Algorithm     autoscale.Algorithm
+	AlgorithmSpec autoscale.AlgorithmSpec
+	Log           *log.Logger
+	Estimator     autoscale.Estimator
 }
 
 func (s *Service) indexHandle(w http.ResponseWriter, r *http.Request) {
@@ -78,7 +79,7 @@ func (s *Service) runScalingHandle(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	runId, err := models.CreateAutoscalingRun(s.DB, friendlyName, time.Now())
+	runId, err := s.Store.CreateAutoscalingRun(friendlyName, time.Now(), s.AlgorithmSpec)
 	if err != nil {
 		s.Log.Print(err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -101,8 +102,14 @@ func (s *Service) runScalingHandle(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	out.Instances, err = autoscale.ApplyActions(s.Clouds, out.Actions, algTimestamp)
+	if err != nil {
+		s.Log.Print(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	for _, job := range out.JobQueue {
-		err = models.InsertAlgorithmJob(s.DB, job, runId)
+		err = s.Store.InsertAlgorithmJob(job, runId)
 		if err != nil {
 			s.Log.Print(err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -135,19 +142,19 @@ func (s *Service) getPreviousScalingHandle(w http.ResponseWriter, r *http.Reques
 	q := raw.Query()
 	if val, ok := q["id"]; ok {
 
-		run, err := models.GetAutoscalingRun(s.DB, val[0])
+		run, err := s.Store.GetAutoscalingRun(val[0])
 		if err != nil && err != sql.ErrNoRows {
 			s.Log.Print(err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		events, err := models.GetAutoscalingRunEvents(s.DB, val[0])
+		events, err := s.Store.GetAutoscalingRunEvents(val[0])
 		if err != nil && err != sql.ErrNoRows {
 			s.Log.Print(err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		jobs, err := models.GetAllAlgorithmJobs(s.DB, val[0])
+		jobs, err := s.Store.GetAllAlgorithmJobs(val[0])
 		if err != nil && err != sql.ErrNoRows {
 			s.Log.Print(err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -184,7 +191,7 @@ func setScalingIds(clouds autoscale.CloudCollection, id string) {
 }
 
 func (s *Service) endRun(id string) error {
-	err := models.UpdateAutoscalingRun(s.DB, id, time.Now())
+	err := s.Store.UpdateAutoscalingRun(id, time.Now())
 	if err != nil {
 		return err
 	}
@@ -3,12 +3,12 @@ package autoscalingService
 import (
 	"github.com/tteige/uit-go/autoscale"
 	"time"
-	"database/sql"
+	"github.com/tteige/uit-go/models"
 )
 
 type CPouta struct {
 	Cluster autoscale.Cluster
-	DB *sql.DB
+	Store models.Store
 }
 
 func (*CPouta) Authenticate() error {
@@ -31,6 +31,10 @@ func (*CPouta) DeleteInstance(id string, currentTime time.Time) error {
 	panic("implement me")
 }
 
+func (*CPouta) DrainInstance(id string, currentTime time.Time) error {
+	panic("implement me")
+}
+
 func (*CPouta) GetInstances() ([]autoscale.Instance, error) {
 	panic("implement me")
 }
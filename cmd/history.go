@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"github.com/tteige/uit-go/config"
+	"github.com/tteige/uit-go/history"
+	"github.com/tteige/uit-go/models"
+	"io"
+	"os"
+	"time"
+)
+
+// runHistoryCommand writes a simulation request that replays the MetaPipe jobs submitted in a date range
+func runHistoryCommand(args []string) error {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	from := fs.String("from", "", "first day of the range, 2006-01-02 or RFC 3339")
+	to := fs.String("to", "", "end of the range, not included, 2006-01-02 or RFC 3339")
+	compression := fs.Float64("compression", 1, "divide the time between the submits by this factor")
+	timestep := fs.Int("timestep", 30, "timestep of the simulation in minutes")
+	name := fs.String("name", "", "name of the simulation, generated if empty")
+	sqlitePath := fs.String("sqlite", "", "read the jobs from this SQLite database instead of the configured database")
+	outFile := fs.String("out", "", "output file, stdout if empty")
+	fs.Parse(args)
+
+	opts := history.Options{
+		Name:        *name,
+		Compression: *compression,
+		Timestep:    *timestep,
+	}
+	var err error
+	opts.From, err = parseDate(*from)
+	if err != nil {
+		return err
+	}
+	opts.To, err = parseDate(*to)
+	if err != nil {
+		return err
+	}
+
+	var store models.Store
+	if *sqlitePath != "" {
+		store, err = models.OpenSQLite(*sqlitePath)
+	} else {
+		conf := config.DatabaseConfig{}
+		err = conf.LoadConfig()
+		if err != nil {
+			return err
+		}
+		store, err = openStore(conf)
+	}
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	reqInput, err := history.Build(store, opts)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *outFile != "" {
+		f, err := os.Create(*outFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(reqInput)
+}
+
+func parseDate(s string) (time.Time, error) {
+	t, err := time.Parse("2006-01-02", s)
+	if err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -13,13 +13,42 @@ import (
 	"github.com/tteige/uit-go/simulator"
 	"log"
 	"os"
-	"database/sql"
+	"strings"
+	"fmt"
 )
 
 func main() {
 
+	if len(os.Args) > 1 && os.Args[1] == "simulate" {
+		err := runSimulateCommand(os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "workload" {
+		err := runWorkloadCommand(os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "history" {
+		err := runHistoryCommand(os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	service := flag.Bool("production", false, "run the auto scaling service")
 	updateDb := flag.Bool("updateDB", false, "update the database on launch")
+	algName := flag.String("algorithm", "naive", "default scaling algorithm, one of "+strings.Join(algorithm.Names(), ", "))
+	algOptions := flag.String("algorithm-options", "", "JSON encoded options of the default scaling algorithm")
+	estName := flag.String("estimator", "linear_regression", "execution time estimator, one of "+strings.Join(estimator.Names(), ", "))
+	estOptions := flag.String("estimator-options", "", "JSON encoded options of the estimator")
+	maxRuns := flag.Int("max-runs", 0, "maximum number of simulations running at the same time, the number of CPUs if 0")
+	flag.Parse()
 
 	conf := config.FullConfig{}
 	err := conf.LoadConfig()
@@ -32,7 +61,7 @@ func main() {
 
 	serviceHostname := conf.ServiceConfig.Hostname + ":" + conf.ServiceConfig.Port
 
-	db, err := models.OpenDatabase(conf.DBConfig.User, conf.DBConfig.Host, conf.DBConfig.Password)
+	store, err := openStore(conf.DBConfig)
 	if err != nil {
 		log.Fatal(err)
 		return
@@ -50,35 +79,43 @@ func main() {
 		return
 	}
 	// TODO: Reinit database periodically, spawn a job that does this every day
-	err = models.InitDatabase(db, auth, *updateDb)
+	err = models.InitDatabase(store, auth, *updateDb)
 	if err != nil {
 		log.Fatal(err)
 		return
 	}
 
-	est := estimator.LinearRegression{
-		Auth: auth,
-		DB:   db,
+	est, err := estimator.New(*estName, estimator.Dependencies{Auth: auth, Store: store}, json.RawMessage(*estOptions))
+	if err != nil {
+		log.Fatal(err)
+		return
 	}
 
-	alg := algorithm.NaiveAlgorithm{}
-	//alg := algorithm.BadAlgorithm{}
-	//alg := algorithm.NilAlg{}
+	algSpec := autoscale.AlgorithmSpec{
+		Name:    *algName,
+		Options: json.RawMessage(*algOptions),
+	}
+	alg, err := algorithm.FromSpec(algSpec)
+	if err != nil {
+		log.Fatal(err)
+		return
+	}
 
 	if *service {
 		clusters, err := loadClusters("CLUSTER_CONFIG")
-		clouds, err := createMetapipeClouds(db, clusters)
+		clouds, err := createMetapipeClouds(store, clusters)
 		if err != nil {
 			return
 		}
 		log.Printf("Starting the auto scaling service at: %s ", serviceHostname)
 		s := autoscalingService.Service{
-			DB:        db,
-			Hostname:  serviceHostname,
-			Clouds:    clouds,
-			Algorithm: alg,
-			Log:       log.New(os.Stdout, "AUTOSCALE LOGGER: ", log.Lshortfile|log.LstdFlags),
-			Estimator: &est,
+			Store:         store,
+			Hostname:      serviceHostname,
+			Clouds:        clouds,
+			Algorithm:     alg,
+			AlgorithmSpec: algSpec,
+			Log:           log.New(os.Stdout, "AUTOSCALE LOGGER: ", log.Lshortfile|log.LstdFlags),
+			Estimator:     est,
 		}
 		s.Run()
 	} else {
@@ -89,47 +126,59 @@ func main() {
 		}
 
 		sim := simulator.Simulator{
-			DB:          db,
-			Hostname:    serviceHostname,
-			Algorithm:   alg,
-			Log:         log.New(os.Stdout, "SIMULATOR LOGGER: ", log.Lshortfile|log.LstdFlags),
-			Estimator:   &est,
-			SimClusters: simClusterMap,
+			Store:             store,
+			Hostname:          serviceHostname,
+			Algorithm:         alg,
+			AlgorithmSpec:     algSpec,
+			Log:               log.New(os.Stdout, "SIMULATOR LOGGER: ", log.Lshortfile|log.LstdFlags),
+			Estimator:         est,
+			EstimatorSpec:     autoscale.EstimatorSpec{Name: *estName, Options: json.RawMessage(*estOptions)},
+			SimClusters:       simClusterMap,
+			MaxConcurrentRuns: *maxRuns,
 		}
 		sim.Run()
 	}
 	return
 }
 
-func createMetapipeClouds(db *sql.DB, clusters autoscale.ClusterCollection) (autoscale.CloudCollection, error) {
+func openStore(conf config.DatabaseConfig) (models.Store, error) {
+	switch conf.Driver {
+	case "", "postgres":
+		return models.OpenDatabase(conf.User, conf.Host, conf.Password)
+	case "sqlite3":
+		return models.OpenSQLite(conf.Path)
+	case "memory":
+		return models.NewMemoryStore(), nil
+	}
+	return nil, fmt.Errorf("unknown database driver %q", conf.Driver)
+}
+
+func createMetapipeClouds(store models.Store, clusters autoscale.ClusterCollection) (autoscale.CloudCollection, error) {
 	simCloudMap := make(autoscale.CloudCollection)
 
 	simCloudMap[metapipe.CPouta] = &autoscalingService.CPouta{
 		Cluster: clusters[metapipe.CPouta],
-		DB:      db,
+		Store:   store,
 	}
 	simCloudMap[metapipe.AWS] = &autoscalingService.Aws{
 		Cluster: clusters[metapipe.AWS],
-		DB:      db,
+		Store:   store,
 	}
 	simCloudMap[metapipe.Stallo] = &autoscalingService.Stallo{
 		Cluster: clusters[metapipe.Stallo],
-		DB:      db,
+		Store:   store,
 	}
 	return simCloudMap, nil
 }
 
 func loadClusters(configEnvName string) (autoscale.ClusterCollection, error) {
-	simClusterMap := make(autoscale.ClusterCollection)
+	return loadClusterFile(os.Getenv(configEnvName))
+}
 
-	configLocation := os.Getenv(configEnvName)
-	reader, err := os.Open(configLocation)
-	if err != nil {
-		return nil, err
-	}
+func loadClusterFile(configLocation string) (autoscale.ClusterCollection, error) {
+	simClusterMap := make(autoscale.ClusterCollection)
 
-	dec := json.NewDecoder(reader)
-	err = dec.Decode(&simClusterMap)
+	err := readJSONFile(configLocation, &simClusterMap)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"github.com/tteige/uit-go/algorithm"
+	"github.com/tteige/uit-go/autoscale"
+	"github.com/tteige/uit-go/estimator"
+	"github.com/tteige/uit-go/metapipe"
+	"github.com/tteige/uit-go/models"
+	"github.com/tteige/uit-go/simulator"
+	"github.com/tteige/uit-go/workload"
+	"github.com/tteige/uit-go/swf"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+)
+
+// runSimulateCommand runs a simulation from a request file without a database server, the MetaPipe API
+// or the HTTP server, and writes the jobs, simulator events and cloud events, or the comparison, sweep,
+// capacity plan or Monte Carlo report, as JSON
+func runSimulateCommand(args []string) error {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	inputFile := fs.String("input", "default_input.json", "simulation request, the same JSON as POST /metapipe/simulate/")
+	clusterFile := fs.String("clusters", os.Getenv("SIM_CLUSTER_CONFIG"), "cluster config used when the request has no clusters")
+	outFile := fs.String("out", "", "output file, stdout if empty")
+	algName := fs.String("algorithm", "naive", "scaling algorithm used when the request has none, one of "+strings.Join(algorithm.Names(), ", "))
+	algOptions := fs.String("algorithm-options", "", "JSON encoded options of the scaling algorithm")
+	estName := fs.String("estimator", "recorded", "execution time estimator, one of "+strings.Join(estimator.Names(), ", "))
+	estOptions := fs.String("estimator-options", "", "JSON encoded options of the estimator")
+	sqlitePath := fs.String("sqlite", "", "store the run in this SQLite database instead of in memory")
+	runs := fs.Int("runs", 0, "Monte Carlo runs, overrides monte_carlo_runs of the request")
+	dispatcher := fs.String("dispatcher", "", "job dispatcher, overrides dispatcher of the request, one of "+strings.Join(autoscale.DispatcherNames(), ", "))
+	replay := fs.String("replay", "", "run this stored run again from its stored input, requires -sqlite")
+	workloadFile := fs.String("workload", "", "workload spec that generates jobs, replaces the workload of the request")
+	compare := fs.String("compare", "", "comma separated algorithms to compare on the same jobs and clusters, replaces compare of the request")
+	sweepFile := fs.String("sweep", "", "sweep spec to run instead of the input, see POST /metapipe/sweep/")
+	planFile := fs.String("plan", "", "capacity plan spec to run instead of the input, see POST /metapipe/plan/")
+	csvFile := fs.String("csv", "", "also write the summary of the -sweep to this file as CSV")
+	swfFile := fs.String("swf", "", "SWF trace to import jobs from, replaces the trace of the request")
+	swfConfig := fs.String("swf-config", "", "JSON config that maps the queues and partitions of the -swf trace to tags")
+	swfOut := fs.String("swf-out", "", "also write the finished jobs of the run to this file as an SWF trace")
+	fs.Parse(args)
+
+	var store models.Store = models.NewMemoryStore()
+	if *sqlitePath != "" {
+		sqlStore, err := models.OpenSQLite(*sqlitePath)
+		if err != nil {
+			return err
+		}
+		store = sqlStore
+	}
+	defer store.Close()
+
+	var reqInput metapipe.ScalingRequestInput
+	var err error
+	var spec simulator.SweepSpec
+	if *sweepFile != "" {
+		err = readJSONFile(*sweepFile, &spec)
+		if err != nil {
+			return err
+		}
+		reqInput = spec.Base
+	}
+	var plan simulator.PlanSpec
+	if *planFile != "" {
+		err = readJSONFile(*planFile, &plan)
+		if err != nil {
+			return err
+		}
+		reqInput = plan.Base
+	}
+	//A replay only needs the stored input of the run, and a sweep or plan has its request in the spec
+	if *replay == "" && *sweepFile == "" && *planFile == "" {
+		err = readJSONFile(*inputFile, &reqInput)
+		if err != nil {
+			return err
+		}
+	}
+	if *runs > 0 {
+		reqInput.MonteCarloRuns = *runs
+	}
+	if *dispatcher != "" {
+		reqInput.Dispatcher = *dispatcher
+	}
+	if *compare != "" {
+		reqInput.Compare = nil
+		for _, name := range strings.Split(*compare, ",") {
+			reqInput.Compare = append(reqInput.Compare, autoscale.AlgorithmSpec{Name: strings.TrimSpace(name)})
+		}
+	}
+	if *workloadFile != "" {
+		reqInput.Workload = new(workload.Spec)
+		err = readJSONFile(*workloadFile, reqInput.Workload)
+		if err != nil {
+			return err
+		}
+	}
+
+	if *swfFile != "" {
+		data, err := ioutil.ReadFile(*swfFile)
+		if err != nil {
+			return err
+		}
+		reqInput.Trace = &swf.Trace{Data: string(data)}
+		if *swfConfig != "" {
+			err = readJSONFile(*swfConfig, &reqInput.Trace.Config)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	clusters := make(autoscale.ClusterCollection)
+	if reqInput.Clusters == nil && *replay == "" {
+		clusters, err = loadClusterFile(*clusterFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	est, err := estimator.New(*estName, estimator.Dependencies{Store: store}, json.RawMessage(*estOptions))
+	if err != nil {
+		return err
+	}
+	err = est.Init()
+	if err != nil {
+		return err
+	}
+
+	algSpec := autoscale.AlgorithmSpec{
+		Name:    *algName,
+		Options: json.RawMessage(*algOptions),
+	}
+	alg, err := algorithm.FromSpec(algSpec)
+	if err != nil {
+		return err
+	}
+
+	sim := simulator.Simulator{
+		Store:         store,
+		Algorithm:     alg,
+		AlgorithmSpec: algSpec,
+		Log:           log.New(os.Stderr, "SIMULATOR LOGGER: ", log.Lshortfile|log.LstdFlags),
+		Estimator:     est,
+		EstimatorSpec: autoscale.EstimatorSpec{Name: *estName, Options: json.RawMessage(*estOptions)},
+		SimClusters:   clusters,
+	}
+	//A Monte Carlo simulation writes the report of its runs instead of the events of a single run
+	var out interface{}
+	if *replay != "" {
+		out, err = sim.Replay(*replay)
+	} else if *sweepFile != "" {
+		spec.Base = reqInput
+		out, err = sim.Sweep(spec)
+	} else if *planFile != "" {
+		plan.Base = reqInput
+		out, err = sim.Plan(plan)
+	} else if len(reqInput.Compare) > 0 {
+		out, err = sim.Compare(reqInput)
+	} else if reqInput.MonteCarloRuns > 0 {
+		out, err = sim.MonteCarlo(reqInput)
+	} else {
+		out, err = sim.Simulate(reqInput)
+	}
+	if err != nil {
+		return err
+	}
+	if summary, ok := out.(simulator.SweepSummary); ok && *csvFile != "" {
+		err = writeCSVFile(*csvFile, summary)
+		if err != nil {
+			return err
+		}
+	}
+	if full, ok := out.(simulator.FullSimulationOutput); ok && *swfOut != "" {
+		err = writeSWFFile(*swfOut, full)
+		if err != nil {
+			return err
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if *outFile != "" {
+		f, err := os.Create(*outFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+func writeCSVFile(location string, summary simulator.SweepSummary) error {
+	f, err := os.Create(location)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return summary.WriteCSV(f)
+}
+
+func writeSWFFile(location string, out simulator.FullSimulationOutput) error {
+	f, err := os.Create(location)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return swf.Write(f, out.Jobs, "simulation "+out.Name)
+}
+
+func readJSONFile(location string, v interface{}) error {
+	reader, err := os.Open(location)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	dec := json.NewDecoder(reader)
+	return dec.Decode(v)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"github.com/tteige/uit-go/workload"
+	"io"
+	"os"
+	"time"
+)
+
+// runWorkloadCommand generates the jobs of a workload spec and writes them as JSON
+func runWorkloadCommand(args []string) error {
+	fs := flag.NewFlagSet("workload", flag.ExitOnError)
+	specFile := fs.String("spec", "workload.json", "workload spec, the same JSON as \"workload\" in a simulation request")
+	outFile := fs.String("out", "", "output file, stdout if empty")
+	seed := fs.Int64("seed", 0, "seed used when the spec has none, a random seed if 0")
+	fs.Parse(args)
+
+	var spec workload.Spec
+	err := readJSONFile(*specFile, &spec)
+	if err != nil {
+		return err
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	jobs, err := workload.Generate(spec, time.Now(), *seed)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *outFile != "" {
+		f, err := os.Create(*outFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(jobs)
+}
@@ -20,6 +20,10 @@ type DatabaseConfig struct {
 	Password string `yaml:"pw"`
 	Host     string `yaml:"host"`
 	User     string `yaml:"user"`
+	// Driver is postgres (default), sqlite3 or memory
+	Driver string `yaml:"driver"`
+	// Path is the database file of the sqlite3 driver
+	Path string `yaml:"path"`
 }
 
 type ServiceConfig struct {
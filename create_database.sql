@@ -43,6 +43,18 @@ ALTER TABLE metapipe_parameters
   ADD CONSTRAINT metapipe_parameters_estimator_training_jobid_fk
 FOREIGN KEY (jobid) REFERENCES estimator_training;
 
+CREATE TABLE IF NOT EXISTS job_attempt
+(
+  jobid     VARCHAR(255) NOT NULL,
+  attemptid VARCHAR(255) NOT NULL,
+  tag       VARCHAR(255),
+  state     VARCHAR(255),
+  submitted TIMESTAMP,
+  started   TIMESTAMP,
+  ended     TIMESTAMP,
+  PRIMARY KEY (jobid, attemptid)
+);
+
 CREATE TABLE IF NOT EXISTS cloud_events
 (
   id             SERIAL NOT NULL,
@@ -68,12 +80,20 @@ PRIMARY KEY (id);
 
 CREATE TABLE IF NOT EXISTS autoscaling_run
 (
-  id       SERIAL       NOT NULL,
-  name     VARCHAR(255) NOT NULL,
-  started  TIMESTAMP,
-  finished TIMESTAMP
+  id                SERIAL       NOT NULL,
+  name              VARCHAR(255) NOT NULL,
+  started           TIMESTAMP,
+  finished          TIMESTAMP,
+  algorithm         VARCHAR(255),
+  algorithm_options TEXT
 );
 
+ALTER TABLE autoscaling_run
+  ADD COLUMN IF NOT EXISTS algorithm VARCHAR(255);
+
+ALTER TABLE autoscaling_run
+  ADD COLUMN IF NOT EXISTS algorithm_options TEXT;
+
 CREATE UNIQUE INDEX IF NOT EXISTS autoscaling_run_id_pk
   ON autoscaling_run (id);
 
@@ -87,6 +107,39 @@ ALTER TABLE autoscaling_run
   ADD CONSTRAINT autoscaling_run_id_pk
 PRIMARY KEY (id);
 
+CREATE TABLE IF NOT EXISTS autoscaling_run_input
+(
+  run_name VARCHAR(255) NOT NULL,
+  input    TEXT
+);
+
+ALTER TABLE autoscaling_run_input
+  ADD CONSTRAINT autoscaling_run_input_pkey
+PRIMARY KEY (run_name);
+
+ALTER TABLE autoscaling_run_input
+  ADD CONSTRAINT autoscaling_run_input_autoscaling_run_name_fk
+FOREIGN KEY (run_name) REFERENCES autoscaling_run (name);
+
+CREATE TABLE IF NOT EXISTS run_group
+(
+  id         SERIAL NOT NULL,
+  group_name VARCHAR(255) NOT NULL,
+  run_name   VARCHAR(255) NOT NULL,
+  labels     TEXT
+);
+
+ALTER TABLE run_group
+  ADD CONSTRAINT run_group_pkey
+PRIMARY KEY (id);
+
+ALTER TABLE run_group
+  ADD CONSTRAINT run_group_autoscaling_run_name_fk
+FOREIGN KEY (run_name) REFERENCES autoscaling_run (name);
+
+CREATE INDEX IF NOT EXISTS run_group_group_name_index
+  ON run_group (group_name);
+
 ALTER TABLE cloud_events
   ADD CONSTRAINT cloud_events_autoscaling_run_name_fk
 FOREIGN KEY (run_name) REFERENCES autoscaling_run (name);
@@ -116,6 +169,58 @@ ALTER TABLE simulator_events
   ADD CONSTRAINT simulator_events_autoscaling_run_name_fk
 FOREIGN KEY (run_name) REFERENCES autoscaling_run (name);
 
+CREATE TABLE IF NOT EXISTS job_assignment
+(
+  id          SERIAL NOT NULL,
+  run_name    VARCHAR(255),
+  jobid       VARCHAR(255),
+  attempt     INTEGER,
+  cloud       VARCHAR(255),
+  instance_id VARCHAR(255),
+  priority    INTEGER,
+  started     TIMESTAMP,
+  ended       TIMESTAMP,
+  state       VARCHAR(255)
+);
+
+ALTER TABLE job_assignment
+  ADD CONSTRAINT job_assignment_pkey
+PRIMARY KEY (id);
+
+ALTER TABLE job_assignment
+  ADD CONSTRAINT job_assignment_autoscaling_run_name_fk
+FOREIGN KEY (run_name) REFERENCES autoscaling_run (name);
+
+CREATE INDEX IF NOT EXISTS job_assignment_run_name_index
+  ON job_assignment (run_name);
+
+CREATE TABLE IF NOT EXISTS cluster_snapshot
+(
+  id             SERIAL NOT NULL,
+  run_name       VARCHAR(255),
+  cloud          VARCHAR(255),
+  taken          TIMESTAMP,
+  instance_limit INTEGER,
+  booting        INTEGER,
+  idle           INTEGER,
+  busy           INTEGER,
+  draining       INTEGER,
+  instance_types TEXT,
+  running_jobs   INTEGER,
+  queued_jobs    INTEGER
+);
+
+ALTER TABLE cluster_snapshot
+  ADD CONSTRAINT cluster_snapshot_pkey
+PRIMARY KEY (id);
+
+ALTER TABLE cluster_snapshot
+  ADD CONSTRAINT cluster_snapshot_autoscaling_run_name_fk
+FOREIGN KEY (run_name) REFERENCES autoscaling_run (name);
+
+CREATE INDEX IF NOT EXISTS cluster_snapshot_run_name_index
+  ON cluster_snapshot (run_name);
+
 CREATE TABLE IF NOT EXISTS algorithm_job
 (
   id            SERIAL NOT NULL,
@@ -127,9 +232,19 @@ CREATE TABLE IF NOT EXISTS algorithm_job
   tag           VARCHAR(255),
   deadline      TIMESTAMP,
   priority      INTEGER,
-  state         VARCHAR(255)
+  state         VARCHAR(255),
+  attempts      INTEGER DEFAULT 0,
+  processors    INTEGER DEFAULT 0,
+  memory        BIGINT DEFAULT 0,
+  instanceid    VARCHAR(255) DEFAULT ''
 );
 
+ALTER TABLE algorithm_job
+  ADD COLUMN IF NOT EXISTS attempts INTEGER DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS processors INTEGER DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS memory BIGINT DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS instanceid VARCHAR(255) DEFAULT '';
+
 CREATE UNIQUE INDEX IF NOT EXISTS algorithm_job_id_uindex
   ON algorithm_job (id);
 
@@ -5,15 +5,24 @@ import (
 	"github.com/sajari/regression"
 	"time"
 	"net/http"
-	"database/sql"
 	"github.com/tteige/uit-go/models"
 	"github.com/tteige/uit-go/metapipe"
+	"database/sql"
 )
 
+type LinearRegressionOptions struct {
+	// Timeout is the timeout in seconds of the requests for the MetaPipe dataset sizes
+	Timeout int `json:"timeout"`
+	// MaxAttempts is the number of retries of a failed request
+	MaxAttempts int `json:"max_attempts"`
+}
+
 type LinearRegression struct {
-	models map[string]*regression.Regression
-	Auth   metapipe.Oath2
-	DB     *sql.DB
+	models    map[string]*regression.Regression
+	residuals map[string][]float64
+	Auth      metapipe.Oath2
+	Store     models.Store
+	Options   LinearRegressionOptions
 }
 
 type RegressionJob struct {
@@ -25,7 +34,7 @@ type RegressionJob struct {
 
 func (lr *LinearRegression) Init() error {
 	var dataPoints []RegressionJob
-	jobs, err := models.GetAllJobs(lr.DB)
+	jobs, err := lr.Store.GetAllJobs()
 	if err != nil {
 		return err
 	}
@@ -33,8 +42,8 @@ func (lr *LinearRegression) Init() error {
 		if j.QueueDuration <= 0 {
 			continue
 		}
-		param, err := models.GetParameters(lr.DB, j.JobId)
-		if err != nil {
+		param, err := lr.Store.GetParameters(j.JobId)
+		if err != nil && err != sql.ErrNoRows {
 			return err
 		}
 		var regJ RegressionJob
@@ -76,6 +85,7 @@ func generateParamBin(params metapipe.Parameters) float64 {
 
 func (lr *LinearRegression) InitModel(dataPoints []RegressionJob) error {
 	lr.models = make(map[string]*regression.Regression)
+	lr.residuals = make(map[string][]float64)
 	dataPointMap := make(map[string]regression.DataPoints)
 
 	for _, j := range dataPoints {
@@ -99,6 +109,13 @@ func (lr *LinearRegression) InitModel(dataPoints []RegressionJob) error {
 		}
 		r.Run()
 		lr.models[key] = r
+		for _, p := range val {
+			pred, err := r.Predict(p.Variables)
+			if err != nil || pred <= 0 {
+				continue
+			}
+			lr.residuals[key] = append(lr.residuals[key], p.Observed/pred)
+		}
 		//log.Printf("__________________________________________________")
 		//log.Printf("Regression formula for %s:\n%v\n", key, r.Formula)
 		//log.Printf("Regression:\n%s\n", r)
@@ -107,6 +124,11 @@ func (lr *LinearRegression) InitModel(dataPoints []RegressionJob) error {
 	return nil
 }
 
+// Residuals returns the actual execution times of the training jobs of the tag divided by their estimates
+func (lr *LinearRegression) Residuals(tag string) []float64 {
+	return lr.residuals[metapipe.GetTag(tag)]
+}
+
 func (lr *LinearRegression) estimateJob(params metapipe.Parameters, tag string, dataSize int64) (int64, error) {
 	pred, err := lr.models[metapipe.GetTag(tag)].Predict([]float64{float64(dataSize), generateParamBin(params), float64(params.InputContigsCutoff)})
 	if err != nil {
@@ -117,11 +139,19 @@ func (lr *LinearRegression) estimateJob(params metapipe.Parameters, tag string,
 
 func (lr *LinearRegression) ProcessQueue(jobs []autoscale.AlgorithmJob) ([]autoscale.AlgorithmJob, error) {
 	out := make([]autoscale.AlgorithmJob, 0)
+	timeout := lr.Options.Timeout
+	if timeout <= 0 {
+		timeout = 5
+	}
+	maxAttempts := lr.Options.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 3
+	}
 	client := metapipe.RetryClient{
 		Auth:        lr.Auth,
-		MaxAttempts: 3,
+		MaxAttempts: maxAttempts,
 		Client: http.Client{
-			Timeout: time.Second * 5,
+			Timeout: time.Second * time.Duration(timeout),
 		},
 	}
 
@@ -0,0 +1,60 @@
+package estimator
+
+import (
+	"github.com/tteige/uit-go/autoscale"
+	"github.com/tteige/uit-go/metapipe"
+	"time"
+)
+
+type RecordedOptions struct {
+	// DefaultRuntime is used in seconds for jobs without a recorded runtime
+	DefaultRuntime int64 `json:"default_runtime"`
+}
+
+// Recorded uses the runtime recorded in the job as the execution time on every cloud the job can run on.
+// It needs neither the database nor the MetaPipe API and is meant for offline simulations
+type Recorded struct {
+	Options RecordedOptions
+}
+
+func (r *Recorded) Init() error {
+	return nil
+}
+
+func (r *Recorded) ProcessQueue(jobs []autoscale.AlgorithmJob) ([]autoscale.AlgorithmJob, error) {
+	out := make([]autoscale.AlgorithmJob, 0)
+	for _, j := range jobs {
+		if j.State == "CANCELLED" {
+			continue
+		}
+
+		newTag := metapipe.GetTag(j.Tag)
+		if newTag == "undefined" {
+			continue
+		}
+
+		var runtime int64
+		for _, t := range j.ExecutionTime {
+			if t > runtime {
+				runtime = t
+			}
+		}
+		if runtime <= 0 {
+			runtime = int64(time.Duration(r.Options.DefaultRuntime) * time.Second / time.Millisecond)
+		}
+
+		execMap := make(map[string]int64)
+		if newTag == "" {
+			execMap[metapipe.AWS] = runtime
+			execMap[metapipe.CPouta] = runtime
+			execMap[metapipe.Stallo] = runtime
+		} else {
+			execMap[newTag] = runtime
+		}
+
+		j.Tag = newTag
+		j.ExecutionTime = execMap
+		out = append(out, j)
+	}
+	return out, nil
+}
@@ -0,0 +1,69 @@
+package estimator
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/tteige/uit-go/autoscale"
+	"github.com/tteige/uit-go/metapipe"
+	"github.com/tteige/uit-go/models"
+	"sort"
+)
+
+// Dependencies are the shared resources available to the estimator constructors
+type Dependencies struct {
+	Auth  metapipe.Oath2
+	Store models.Store
+}
+
+// Constructor creates an estimator from its JSON encoded options, empty options gives the default estimator
+type Constructor func(deps Dependencies, options json.RawMessage) (autoscale.Estimator, error)
+
+var registry = make(map[string]Constructor)
+
+func init() {
+	Register("linear_regression", func(deps Dependencies, options json.RawMessage) (autoscale.Estimator, error) {
+		lr := &LinearRegression{
+			Auth:  deps.Auth,
+			Store: deps.Store,
+			Options: LinearRegressionOptions{
+				Timeout:     5,
+				MaxAttempts: 3,
+			},
+		}
+		err := autoscale.DecodeOptions(options, &lr.Options)
+		return lr, err
+	})
+	Register("recorded", func(deps Dependencies, options json.RawMessage) (autoscale.Estimator, error) {
+		r := &Recorded{
+			Options: RecordedOptions{
+				DefaultRuntime: 3600,
+			},
+		}
+		err := autoscale.DecodeOptions(options, &r.Options)
+		return r, err
+	})
+}
+
+// Register makes an estimator available by name, registering the same name twice replaces the first constructor
+func Register(name string, constructor Constructor) {
+	registry[name] = constructor
+}
+
+// New creates the estimator registered with the name
+func New(name string, deps Dependencies, options json.RawMessage) (autoscale.Estimator, error) {
+	constructor, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown estimator %q, available estimators are %v", name, Names())
+	}
+	return constructor(deps, options)
+}
+
+// Names returns the registered estimator names in sorted order
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
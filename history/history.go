@@ -0,0 +1,123 @@
+package history
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/tteige/uit-go/metapipe"
+	"github.com/tteige/uit-go/models"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Options selects the historical jobs of a replay
+type Options struct {
+	// Name of the simulation, a name is generated by the simulator if it is empty
+	Name string
+	// From and To are the range of the submit times of the jobs, To is not included
+	From time.Time
+	To   time.Time
+	// Compression divides the time from From to every submit, so the jobs of a month can arrive in a week.
+	// The runtimes are not compressed. The historical submit times are used if it is 0 or 1
+	Compression float64
+	// Timestep of the simulation in minutes, 30 if zero
+	Timestep int
+}
+
+// Build creates a simulation request with the finished MetaPipe jobs that were submitted in the range of the
+// options. The jobs arrive at their submit time, with the runtime, tag and parameters stored by InitDatabase.
+// The simulation starts at From and runs until the last job could have finished
+func Build(store models.Store, opts Options) (metapipe.ScalingRequestInput, error) {
+	if !opts.From.Before(opts.To) {
+		return metapipe.ScalingRequestInput{}, fmt.Errorf("the range from %s to %s is empty", opts.From, opts.To)
+	}
+	if opts.Compression < 0 {
+		return metapipe.ScalingRequestInput{}, fmt.Errorf("the compression must be positive")
+	}
+	compression := opts.Compression
+	if compression == 0 {
+		compression = 1
+	}
+	timestep := opts.Timestep
+	if timestep <= 0 {
+		timestep = 30
+	}
+
+	attempts, err := store.GetAllJobAttempts()
+	if err != nil && err != sql.ErrNoRows {
+		return metapipe.ScalingRequestInput{}, err
+	}
+	//A job was submitted with its first attempt
+	submitted := make(map[string]time.Time)
+	for _, a := range attempts {
+		if a.Submitted.IsZero() {
+			continue
+		}
+		if t, ok := submitted[a.JobId]; !ok || a.Submitted.Before(t) {
+			submitted[a.JobId] = a.Submitted
+		}
+	}
+	ids := make([]string, 0, len(submitted))
+	for id, t := range submitted {
+		if !t.Before(opts.From) && t.Before(opts.To) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if submitted[ids[i]].Equal(submitted[ids[j]]) {
+			return ids[i] < ids[j]
+		}
+		return submitted[ids[i]].Before(submitted[ids[j]])
+	})
+
+	var jobs []metapipe.Job
+	end := opts.From
+	for _, id := range ids {
+		training, err := store.GetJob(id)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return metapipe.ScalingRequestInput{}, err
+		}
+		//Jobs without parameters are replayed with the default ones
+		par, err := store.GetParameters(id)
+		if err != nil && err != sql.ErrNoRows {
+			return metapipe.ScalingRequestInput{}, err
+		}
+
+		submit := opts.From.Add(time.Duration(float64(submitted[id].Sub(opts.From)) / compression))
+		if finish := submit.Add(time.Duration(training.Runtime) * time.Millisecond); finish.After(end) {
+			end = finish
+		}
+		jobs = append(jobs, metapipe.Job{
+			Id:                       id,
+			TimeSubmitted:            timestamp(submit),
+			State:                    "QUEUED",
+			Tag:                      training.Tag,
+			Parameters:               par.MP,
+			TotalRuntimeMillis:       training.Runtime,
+			TotalQueueDurationMillis: training.QueueDuration,
+			//The conversion of the jobs reads the start time of the first attempt, the replayed job has not started
+			Attempts: []metapipe.Attempt{{AttemptId: "replay", State: "QUEUED", Tag: training.Tag}},
+		})
+	}
+	if len(jobs) == 0 {
+		return metapipe.ScalingRequestInput{}, fmt.Errorf("no finished jobs were submitted from %s to %s", opts.From, opts.To)
+	}
+
+	step := time.Duration(timestep) * time.Minute
+	return metapipe.ScalingRequestInput{
+		Name:       opts.Name,
+		Jobs:       jobs,
+		StartTime:  timestamp(opts.From),
+		Timestep:   timestep,
+		Iterations: int(math.Ceil(float64(end.Sub(opts.From))/float64(step))) + 1,
+	}, nil
+}
+
+// timestamp formats t as the milliseconds since the epoch like the MetaPipe API
+func timestamp(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+}
@@ -7,6 +7,8 @@ import (
 	"encoding/json"
 	"log"
 	"github.com/tteige/uit-go/autoscale"
+	"github.com/tteige/uit-go/workload"
+	"github.com/tteige/uit-go/swf"
 )
 
 type Oath2 struct {
@@ -22,6 +24,23 @@ type ScalingRequestInput struct {
 	StartTime  string                      `json:"start_time"`
 	Iterations int                         `json:"iterations"`
 	Timestep   int                         `json:"timestep"`
+	Algorithm  *autoscale.AlgorithmSpec    `json:"algorithm"`
+	// Mode is "event" (default) or "tick" for the fixed timestep simulation
+	Mode string `json:"mode"`
+	// Dispatcher orders the queued jobs onto free instances, "priority" if empty
+	Dispatcher string `json:"dispatcher"`
+	// Noise is the execution time noise of each cloud, the execution times are exact for clouds without noise
+	Noise map[string]autoscale.NoiseSpec `json:"noise"`
+	// Seed of the random noise, a random seed is used if zero
+	Seed int64 `json:"seed"`
+	// MonteCarloRuns runs the same simulation this many times with the seeds Seed, Seed+1, ...
+	MonteCarloRuns int `json:"monte_carlo_runs"`
+	// Compare runs the request once with each of these algorithms and reports them side by side
+	Compare []autoscale.AlgorithmSpec `json:"compare"`
+	// Workload generates synthetic jobs, they are added to the jobs of the request
+	Workload *workload.Spec `json:"workload"`
+	// Trace imports the jobs of an SWF trace, they are added to the jobs of the request
+	Trace *swf.Trace `json:"trace"`
 }
 
 func (o *Oath2) GetSetAccessToken() (string, error) {
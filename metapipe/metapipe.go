@@ -170,7 +170,7 @@ func ConvertMetapipeQueueToAlgInputJobs(jobs []Job) ([]autoscale.AlgorithmJob, e
 			Parameters:    ConvertFromMetapipeParameters(j.Parameters),
 			State:         j.State,
 			Priority:      j.Priority,
-			ExecutionTime: map[string]int64{j.Tag:0},
+			ExecutionTime: map[string]int64{j.Tag: j.TotalRuntimeMillis},
 			Deadline:      time.Time{},
 			Created:       t,
 			Started:       start,
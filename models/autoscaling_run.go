@@ -2,8 +2,8 @@ package models
 
 import (
 	"time"
-	"database/sql"
 	"github.com/lib/pq"
+	"github.com/tteige/uit-go/autoscale"
 )
 
 type AutoscalingRun struct {
@@ -12,35 +12,44 @@ type AutoscalingRun struct {
 }
 
 type AutoscalingRunStats struct {
-	Id       int
-	Name     string
-	Started  time.Time
-	Finished pq.NullTime
+	Id               int
+	Name             string
+	Started          time.Time
+	Finished         pq.NullTime
+	Algorithm        string
+	AlgorithmOptions string
 }
 
-func GetAllAutoscalingRunStats(db *sql.DB) ([]AutoscalingRunStats, error) {
+const autoscalingRunColumns = "id, name, started, finished, COALESCE(algorithm, ''), COALESCE(algorithm_options, '')"
+
+func (s *SQLStore) GetAllAutoscalingRunStats() ([]AutoscalingRunStats, error) {
 	stats := make([]AutoscalingRunStats, 0)
-	rows, err := db.Query("SELECT * FROM autoscaling_run")
+	rows, err := s.query("SELECT " + autoscalingRunColumns + " FROM autoscaling_run")
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	for rows.Next() {
 		var run AutoscalingRunStats
-		err = rows.Scan(&run.Id, &run.Name, &run.Started, &run.Finished)
+		err = rows.Scan(&run.Id, &run.Name, &run.Started, &run.Finished, &run.Algorithm, &run.AlgorithmOptions)
 		if err != nil {
 			return nil, err
 		}
 		stats = append(stats, run)
 	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
 
 	return stats, nil
 }
 
-func GetAutoscalingRunEvents(db *sql.DB, runId string) ([]CloudEvent, error) {
-	rows, err := db.Query("SELECT * FROM cloud_events WHERE run_name = $1", runId)
+func (s *SQLStore) GetAutoscalingRunEvents(runId string) ([]CloudEvent, error) {
+	rows, err := s.query("SELECT * FROM cloud_events WHERE run_name = $1 ORDER BY created, id", runId)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	events := make([]CloudEvent, 0)
 
@@ -53,19 +62,22 @@ func GetAutoscalingRunEvents(db *sql.DB, runId string) ([]CloudEvent, error) {
 		event.Instance.Type = event.InstanceType.Name
 		events = append(events, event)
 	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
 
 	return events, nil
 }
 
-func GetAutoscalingRun(db *sql.DB, runName string) (*AutoscalingRun, error) {
+func (s *SQLStore) GetAutoscalingRun(runName string) (*AutoscalingRun, error) {
 	run := new(AutoscalingRun)
-	err := db.QueryRow("SELECT * FROM autoscaling_run WHERE name = $1", runName).Scan(
-		&run.Id, &run.Name, &run.Started, &run.Finished)
+	err := s.queryRow("SELECT "+autoscalingRunColumns+" FROM autoscaling_run WHERE name = $1", runName).Scan(
+		&run.Id, &run.Name, &run.Started, &run.Finished, &run.Algorithm, &run.AlgorithmOptions)
 	if err != nil {
 		return nil, err
 	}
 
-	events, err := GetAutoscalingRunEvents(db, runName)
+	events, err := s.GetAutoscalingRunEvents(runName)
 	if err != nil {
 		return nil, err
 	}
@@ -74,23 +86,73 @@ func GetAutoscalingRun(db *sql.DB, runName string) (*AutoscalingRun, error) {
 	return run, nil
 }
 
-func UpdateAutoscalingRun(db *sql.DB, run string, finTime time.Time) error {
-	_, err := db.Exec("UPDATE autoscaling_run SET finished = $1 WHERE name = $2", finTime, run)
+func (s *SQLStore) UpdateAutoscalingRun(run string, finTime time.Time) error {
+	_, err := s.exec("UPDATE autoscaling_run SET finished = $1 WHERE name = $2", finTime, run)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func CreateAutoscalingRun(db *sql.DB, runName string, startTime time.Time) (string, error) {
-	_, err := db.Exec("INSERT INTO autoscaling_run (name, started) VALUES ($1, $2)",
-		runName, startTime)
+func (s *SQLStore) CreateAutoscalingRun(runName string, startTime time.Time, alg autoscale.AlgorithmSpec) (string, error) {
+	_, err := s.exec("INSERT INTO autoscaling_run (name, started, algorithm, algorithm_options) VALUES ($1, $2, $3, $4)",
+		runName, startTime, alg.Name, string(alg.Options))
 	if err != nil {
 		return "", err
 	}
-	sim, err := GetAutoscalingRun(db, runName)
+	sim, err := s.GetAutoscalingRun(runName)
 	if err != nil {
 		return "", err
 	}
 	return sim.Name, nil
 }
+
+// InsertAutoscalingRunInput stores the JSON encoded input of a run, everything needed to run it again
+func (s *SQLStore) InsertAutoscalingRunInput(runName string, input []byte) error {
+	_, err := s.exec("INSERT INTO autoscaling_run_input (run_name, input) VALUES ($1, $2)", runName, string(input))
+	return err
+}
+
+func (s *SQLStore) GetAutoscalingRunInput(runName string) ([]byte, error) {
+	var input string
+	err := s.queryRow("SELECT input FROM autoscaling_run_input WHERE run_name = $1", runName).Scan(&input)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(input), nil
+}
+
+// RunGroupMember is a run of a group of runs, such as a parameter sweep. Labels is the JSON encoded description
+// of the run within the group
+type RunGroupMember struct {
+	Group   string
+	RunName string
+	Labels  []byte
+}
+
+func (s *SQLStore) InsertRunGroupMember(member RunGroupMember) error {
+	_, err := s.exec("INSERT INTO run_group (group_name, run_name, labels) VALUES ($1, $2, $3)",
+		member.Group, member.RunName, string(member.Labels))
+	return err
+}
+
+// GetRunGroup returns the runs of the group in the order they were added
+func (s *SQLStore) GetRunGroup(group string) ([]RunGroupMember, error) {
+	rows, err := s.query("SELECT group_name, run_name, labels FROM run_group WHERE group_name = $1 ORDER BY id", group)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var members []RunGroupMember
+	for rows.Next() {
+		var member RunGroupMember
+		var labels string
+		err = rows.Scan(&member.Group, &member.RunName, &labels)
+		if err != nil {
+			return nil, err
+		}
+		member.Labels = []byte(labels)
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
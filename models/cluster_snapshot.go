@@ -0,0 +1,64 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ClusterSnapshot is the state of a cloud after an algorithm run: how many of its instances are in each state and
+// of each instance type, how many jobs are running on it and queued for it, and its instance limit
+type ClusterSnapshot struct {
+	RunName     string
+	Cloud       string
+	Timestamp   time.Time
+	Limit       int
+	Booting     int
+	Idle        int
+	Busy        int
+	Draining    int
+	Types       map[string]int
+	RunningJobs int
+	QueuedJobs  int
+}
+
+func (s *SQLStore) InsertClusterSnapshot(snapshot ClusterSnapshot) error {
+	types, err := json.Marshal(snapshot.Types)
+	if err != nil {
+		return err
+	}
+	_, err = s.exec("INSERT INTO cluster_snapshot (run_name, cloud, taken, instance_limit, booting, idle, busy, draining, instance_types, running_jobs, queued_jobs) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
+		snapshot.RunName, snapshot.Cloud, snapshot.Timestamp, snapshot.Limit, snapshot.Booting, snapshot.Idle, snapshot.Busy,
+		snapshot.Draining, string(types), snapshot.RunningJobs, snapshot.QueuedJobs)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *SQLStore) GetClusterSnapshots(runName string) ([]ClusterSnapshot, error) {
+	rows, err := s.query("SELECT run_name, cloud, taken, instance_limit, booting, idle, busy, draining, instance_types, running_jobs, queued_jobs FROM cluster_snapshot WHERE run_name = $1 ORDER BY taken, cloud", runName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []ClusterSnapshot
+	for rows.Next() {
+		var snapshot ClusterSnapshot
+		var types string
+		err := rows.Scan(&snapshot.RunName, &snapshot.Cloud, &snapshot.Timestamp, &snapshot.Limit, &snapshot.Booting,
+			&snapshot.Idle, &snapshot.Busy, &snapshot.Draining, &types, &snapshot.RunningJobs, &snapshot.QueuedJobs)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal([]byte(types), &snapshot.Types)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
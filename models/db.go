@@ -3,6 +3,7 @@ package models
 import (
 	"database/sql"
 	_ "github.com/lib/pq"
+	"regexp"
 	"net/http"
 	"strconv"
 	"fmt"
@@ -43,20 +44,64 @@ func getTotalDuration(job metapipe.Job) (int64, error) {
 	return totalDuration, nil
 }
 
-func insertJobAndParam(db *sql.DB, job Job, par Parameters) error {
-	err := InsertJob(db, job)
+func insertJobAndParam(store Store, job Job, par Parameters) error {
+	err := store.InsertJob(job)
 	if err != nil {
 		return err
 	}
 
-	err = InsertParameter(db, par)
+	err = store.InsertParameter(par)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func InitDatabase(db *sql.DB, auth metapipe.Oath2, fetchNewJobs bool) error {
+// insertAttempts stores the submit, start and end times of every attempt of the job. An attempt without a created
+// time was submitted with the job, and the last heartbeat is its end if it has no end time
+func insertAttempts(store Store, job metapipe.Job) error {
+	for _, a := range job.Attempts {
+		attempt := JobAttempt{
+			JobId:     job.Id,
+			AttemptId: a.AttemptId,
+			Tag:       a.Tag,
+			State:     a.State,
+		}
+		submitted := a.TimeCreated
+		if submitted == "" {
+			submitted = job.TimeSubmitted
+		}
+		ended := a.TimeEnded
+		if ended == "" {
+			ended = a.LastHeartbeat
+		}
+		stamps := []struct {
+			stamp string
+			t     *time.Time
+		}{
+			{submitted, &attempt.Submitted},
+			{a.TimeStarted, &attempt.Started},
+			{ended, &attempt.Ended},
+		}
+		for _, s := range stamps {
+			if s.stamp == "" {
+				continue
+			}
+			t, err := metapipe.ParseMetapipeTimestamp(s.stamp)
+			if err != nil {
+				return err
+			}
+			*s.t = t.UTC()
+		}
+		err := store.InsertJobAttempt(attempt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func InitDatabase(store Store, auth metapipe.Oath2, fetchNewJobs bool) error {
 
 	if !fetchNewJobs {
 		return nil
@@ -100,11 +145,16 @@ func InitDatabase(db *sql.DB, auth metapipe.Oath2, fetchNewJobs bool) error {
 	log.Printf("Begin insertions")
 	for _, job := range all {
 		if job.State == "FINISHED" {
-			exists, err := CheckExists(db, job.Id)
+			exists, err := store.CheckExists(job.Id)
 			if err != nil {
 				return err
 			}
 			if exists {
+				//Jobs fetched before the attempts were stored get them now
+				err = insertAttempts(store, job)
+				if err != nil {
+					return err
+				}
 				continue
 			}
 			totalDuration, err := getTotalDuration(job)
@@ -134,7 +184,11 @@ func InitDatabase(db *sql.DB, auth metapipe.Oath2, fetchNewJobs bool) error {
 				return err
 			}
 
-			err = insertJobAndParam(db, dbJob, par)
+			err = insertJobAndParam(store, dbJob, par)
+			if err != nil {
+				return err
+			}
+			err = insertAttempts(store, job)
 			if err != nil {
 				return err
 			}
@@ -145,7 +199,23 @@ func InitDatabase(db *sql.DB, auth metapipe.Oath2, fetchNewJobs bool) error {
 	return nil
 }
 
-func OpenDatabase(DB_USER string, DB_NAME string, DB_PASSWORD string) (*sql.DB, error) {
+const (
+	postgresDialect = "postgres"
+	sqliteDialect   = "sqlite3"
+)
+
+// SQLStore is the Store of a Postgres or SQLite database. The queries are written for Postgres,
+// the placeholders are rewritten when the database is SQLite
+type SQLStore struct {
+	DB      *sql.DB
+	dialect string
+}
+
+func NewPostgresStore(db *sql.DB) *SQLStore {
+	return &SQLStore{DB: db, dialect: postgresDialect}
+}
+
+func OpenDatabase(DB_USER string, DB_NAME string, DB_PASSWORD string) (*SQLStore, error) {
 	dbStr := fmt.Sprintf("user=%s password=%s dbname=%s sslmode=disable", DB_USER, DB_PASSWORD, DB_NAME)
 	db, err := sql.Open("postgres", dbStr)
 	if err != nil {
@@ -154,5 +224,31 @@ func OpenDatabase(DB_USER string, DB_NAME string, DB_PASSWORD string) (*sql.DB,
 	if err = db.Ping(); err != nil {
 		return nil, err
 	}
-	return db, nil
+	return NewPostgresStore(db), nil
+}
+
+func (s *SQLStore) Close() error {
+	return s.DB.Close()
+}
+
+var placeholder = regexp.MustCompile(`\$(\d+)`)
+
+// SQLite reads $1 as a named parameter, ?1 keeps the numbered placeholders of the Postgres queries
+func (s *SQLStore) rebind(query string) string {
+	if s.dialect != sqliteDialect {
+		return query
+	}
+	return placeholder.ReplaceAllString(query, "?$1")
+}
+
+func (s *SQLStore) exec(query string, args ...interface{}) (sql.Result, error) {
+	return s.DB.Exec(s.rebind(query), args...)
+}
+
+func (s *SQLStore) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return s.DB.Query(s.rebind(query), args...)
+}
+
+func (s *SQLStore) queryRow(query string, args ...interface{}) *sql.Row {
+	return s.DB.QueryRow(s.rebind(query), args...)
 }
@@ -1,7 +1,6 @@
 package models
 
 import (
-	"database/sql"
 	"log"
 )
 
@@ -13,24 +12,21 @@ type Job struct {
 	QueueDuration int64
 }
 
-func CheckExists(db *sql.DB, jobId string) (bool, error) {
+func (s *SQLStore) CheckExists(jobId string) (bool, error) {
 	existStmt :=
 		`SELECT EXISTS(SELECT 1 FROM estimator_training WHERE jobid = $1)`
 
-	_, err := db.Query(existStmt, jobId)
-
-	if err != nil && err != sql.ErrNoRows {
-		log.Fatalf("Error when initializing the database: %s", err)
-	}
-	if err == sql.ErrNoRows {
+	var exists bool
+	err := s.queryRow(existStmt, jobId).Scan(&exists)
+	if err != nil {
 		return false, err
 	}
-	return true, err
+	return exists, nil
 }
 
-func GetJob(db *sql.DB, jobId string) (Job, error) {
+func (s *SQLStore) GetJob(jobId string) (Job, error) {
 	var job Job
-	err := db.QueryRow("SELECT * FROM estimator_training WHERE jobid = $1", jobId).Scan(&job.Runtime, &job.Tag, &job.JobId,
+	err := s.queryRow("SELECT * FROM estimator_training WHERE jobid = $1", jobId).Scan(&job.Runtime, &job.Tag, &job.JobId,
 		&job.InputDataSize, &job.QueueDuration)
 	if err != nil {
 		return Job{}, err
@@ -38,12 +34,12 @@ func GetJob(db *sql.DB, jobId string) (Job, error) {
 	return job, nil
 }
 
-func GetAllJobs(db *sql.DB) ([]*Job, error) {
-	rows, err := db.Query("SELECT * FROM estimator_training")
-	defer rows.Close()
+func (s *SQLStore) GetAllJobs() ([]*Job, error) {
+	rows, err := s.query("SELECT * FROM estimator_training")
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	jobs := make([]*Job, 0)
 
@@ -63,7 +59,7 @@ func GetAllJobs(db *sql.DB) ([]*Job, error) {
 	return jobs, nil
 }
 
-func InsertJob(db *sql.DB, job Job) error {
+func (s *SQLStore) InsertJob(job Job) error {
 	log.Printf("Inserting job %v", job)
 	sqlStmt :=
 		`INSERT INTO estimator_training (jobid, runtime, tag, datasetsize, queueduration)
@@ -71,14 +67,14 @@ func InsertJob(db *sql.DB, job Job) error {
 		ON CONFLICT (jobid)
 		DO NOTHING`
 
-	_, err := db.Exec(sqlStmt, job.JobId, job.Runtime, job.Tag, job.InputDataSize, job.QueueDuration)
+	_, err := s.exec(sqlStmt, job.JobId, job.Runtime, job.Tag, job.InputDataSize, job.QueueDuration)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func UpdateJob(db *sql.DB, job Job) error {
+func (s *SQLStore) UpdateJob(job Job) error {
 
 	sqlStmt :=
 		`UPDATE estimator_training 
@@ -86,7 +82,7 @@ func UpdateJob(db *sql.DB, job Job) error {
 		WHERE jobid = $1
 		`
 	log.Println("Inserting ", job)
-	_, err := db.Exec(sqlStmt, job.JobId, job.Runtime, job.Tag, job.InputDataSize, job.QueueDuration)
+	_, err := s.exec(sqlStmt, job.JobId, job.Runtime, job.Tag, job.InputDataSize, job.QueueDuration)
 	if err != nil {
 		return err
 	}
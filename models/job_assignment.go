@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+)
+
+// JobAssignment is an attempt of a job running on an instance in a run. End is when the job finished, was lost
+// with its instance or the run ended, State is FINISHED, LOST or RUNNING accordingly
+type JobAssignment struct {
+	RunName    string
+	JobId      string
+	Attempt    int
+	Cloud      string
+	InstanceId string
+	Priority   int
+	Start      time.Time
+	End        time.Time
+	State      string
+}
+
+func (s *SQLStore) InsertJobAssignment(a JobAssignment) error {
+	_, err := s.exec("INSERT INTO job_assignment (run_name, jobid, attempt, cloud, instance_id, priority, started, ended, state) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)",
+		a.RunName, a.JobId, a.Attempt, a.Cloud, a.InstanceId, a.Priority, a.Start, a.End, a.State)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *SQLStore) GetJobAssignments(runName string) ([]JobAssignment, error) {
+	rows, err := s.query("SELECT run_name, jobid, attempt, cloud, instance_id, priority, started, ended, state FROM job_assignment WHERE run_name = $1 ORDER BY started, id", runName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var assignments []JobAssignment
+	for rows.Next() {
+		var a JobAssignment
+		err := rows.Scan(&a.RunName, &a.JobId, &a.Attempt, &a.Cloud, &a.InstanceId, &a.Priority, &a.Start, &a.End, &a.State)
+		if err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, a)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return assignments, nil
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+)
+
+// JobAttempt is one attempt of a finished MetaPipe job, Submitted is when the attempt was created
+type JobAttempt struct {
+	JobId     string
+	AttemptId string
+	Tag       string
+	State     string
+	Submitted time.Time
+	Started   time.Time
+	Ended     time.Time
+}
+
+func (s *SQLStore) InsertJobAttempt(attempt JobAttempt) error {
+	sqlStmt :=
+		`INSERT INTO job_attempt (jobid, attemptid, tag, state, submitted, started, ended)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (jobid, attemptid)
+		DO NOTHING`
+
+	_, err := s.exec(sqlStmt, attempt.JobId, attempt.AttemptId, attempt.Tag, attempt.State, attempt.Submitted,
+		attempt.Started, attempt.Ended)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *SQLStore) GetAllJobAttempts() ([]JobAttempt, error) {
+	rows, err := s.query("SELECT * FROM job_attempt ORDER BY submitted")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []JobAttempt
+	for rows.Next() {
+		var a JobAttempt
+		err := rows.Scan(&a.JobId, &a.AttemptId, &a.Tag, &a.State, &a.Submitted, &a.Started, &a.Ended)
+		if err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, a)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return attempts, nil
+}
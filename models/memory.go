@@ -0,0 +1,326 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/tteige/uit-go/autoscale"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that keeps everything in memory, it is used to run simulations without a database server.
+// Missing rows give sql.ErrNoRows like the SQL stores
+type MemoryStore struct {
+	mu          sync.Mutex
+	runs        []AutoscalingRunStats
+	runInputs   map[string][]byte
+	groups      []RunGroupMember
+	cloudEvents []CloudEvent
+	simEvents   []SimulatorEvent
+	jobs        map[string][]autoscale.AlgorithmJob
+	assignments map[string][]JobAssignment
+	snapshots   map[string][]ClusterSnapshot
+	training    []*Job
+	parameters  map[string]Parameters
+	attempts    []JobAttempt
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		runInputs:   make(map[string][]byte),
+		jobs:        make(map[string][]autoscale.AlgorithmJob),
+		assignments: make(map[string][]JobAssignment),
+		snapshots:   make(map[string][]ClusterSnapshot),
+		parameters:  make(map[string]Parameters),
+	}
+}
+
+func (m *MemoryStore) CreateAutoscalingRun(runName string, startTime time.Time, alg autoscale.AlgorithmSpec) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.findRun(runName) >= 0 {
+		return "", fmt.Errorf("autoscaling run %q already exists", runName)
+	}
+	m.runs = append(m.runs, AutoscalingRunStats{
+		Id:               len(m.runs) + 1,
+		Name:             runName,
+		Started:          startTime,
+		Algorithm:        alg.Name,
+		AlgorithmOptions: string(alg.Options),
+	})
+	return runName, nil
+}
+
+func (m *MemoryStore) UpdateAutoscalingRun(run string, finTime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if i := m.findRun(run); i >= 0 {
+		m.runs[i].Finished = pq.NullTime{Time: finTime, Valid: true}
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetAutoscalingRun(runName string) (*AutoscalingRun, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.findRun(runName)
+	if i < 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &AutoscalingRun{
+		AutoscalingRunStats: m.runs[i],
+		Events:              m.runEvents(runName),
+	}, nil
+}
+
+func (m *MemoryStore) GetAllAutoscalingRunStats() ([]AutoscalingRunStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append(make([]AutoscalingRunStats, 0, len(m.runs)), m.runs...), nil
+}
+
+func (m *MemoryStore) GetAutoscalingRunEvents(runId string) ([]CloudEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.runEvents(runId), nil
+}
+
+func (m *MemoryStore) WriteSimEvent(event CloudEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	event.Id = len(m.cloudEvents) + 1
+	m.cloudEvents = append(m.cloudEvents, event)
+	return nil
+}
+
+func (m *MemoryStore) InsertSimulatorEvent(event SimulatorEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.simEvents = append(m.simEvents, event)
+	return nil
+}
+
+func (m *MemoryStore) GetSimulatorEvents(runName string) ([]SimulatorEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var events []SimulatorEvent
+	for _, e := range m.simEvents {
+		if e.RunName == runName {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (m *MemoryStore) InsertAlgorithmJob(job autoscale.AlgorithmJob, runName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	//Only the execution time of the tag is stored, as in the algorithm_job table
+	job.ExecutionTime = map[string]int64{job.Tag: job.ExecutionTime[job.Tag]}
+	m.jobs[runName] = append(m.jobs[runName], job)
+	return nil
+}
+
+func (m *MemoryStore) GetAllAlgorithmJobs(runName string) ([]autoscale.AlgorithmJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]autoscale.AlgorithmJob(nil), m.jobs[runName]...), nil
+}
+
+func (m *MemoryStore) InsertJobAssignment(a JobAssignment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.assignments[a.RunName] = append(m.assignments[a.RunName], a)
+	return nil
+}
+
+func (m *MemoryStore) GetJobAssignments(runName string) ([]JobAssignment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	assignments := append([]JobAssignment(nil), m.assignments[runName]...)
+	sort.SliceStable(assignments, func(i, j int) bool {
+		return assignments[i].Start.Before(assignments[j].Start)
+	})
+	return assignments, nil
+}
+
+func (m *MemoryStore) InsertClusterSnapshot(snapshot ClusterSnapshot) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snapshots[snapshot.RunName] = append(m.snapshots[snapshot.RunName], snapshot)
+	return nil
+}
+
+func (m *MemoryStore) GetClusterSnapshots(runName string) ([]ClusterSnapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snapshots := append([]ClusterSnapshot(nil), m.snapshots[runName]...)
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		if !snapshots[i].Timestamp.Equal(snapshots[j].Timestamp) {
+			return snapshots[i].Timestamp.Before(snapshots[j].Timestamp)
+		}
+		return snapshots[i].Cloud < snapshots[j].Cloud
+	})
+	return snapshots, nil
+}
+
+func (m *MemoryStore) CheckExists(jobId string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.findJob(jobId) >= 0, nil
+}
+
+func (m *MemoryStore) GetJob(jobId string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.findJob(jobId)
+	if i < 0 {
+		return Job{}, sql.ErrNoRows
+	}
+	return *m.training[i], nil
+}
+
+func (m *MemoryStore) GetAllJobs() ([]*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	jobs := make([]*Job, 0, len(m.training))
+	for _, j := range m.training {
+		job := *j
+		jobs = append(jobs, &job)
+	}
+	return jobs, nil
+}
+
+func (m *MemoryStore) InsertJob(job Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.findJob(job.JobId) >= 0 {
+		return nil
+	}
+	m.training = append(m.training, &job)
+	return nil
+}
+
+func (m *MemoryStore) UpdateJob(job Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if i := m.findJob(job.JobId); i >= 0 {
+		*m.training[i] = job
+	}
+	return nil
+}
+
+func (m *MemoryStore) InsertParameter(par Parameters) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.parameters[par.JobId]; !ok {
+		m.parameters[par.JobId] = par
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetParameters(jobId string) (Parameters, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	par, ok := m.parameters[jobId]
+	if !ok {
+		return Parameters{}, sql.ErrNoRows
+	}
+	return par, nil
+}
+
+func (m *MemoryStore) InsertJobAttempt(attempt JobAttempt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, a := range m.attempts {
+		if a.JobId == attempt.JobId && a.AttemptId == attempt.AttemptId {
+			return nil
+		}
+	}
+	m.attempts = append(m.attempts, attempt)
+	return nil
+}
+
+func (m *MemoryStore) GetAllJobAttempts() ([]JobAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	attempts := append([]JobAttempt(nil), m.attempts...)
+	sort.SliceStable(attempts, func(i, j int) bool {
+		return attempts[i].Submitted.Before(attempts[j].Submitted)
+	})
+	return attempts, nil
+}
+
+func (m *MemoryStore) InsertAutoscalingRunInput(runName string, input []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.runInputs[runName]; ok {
+		return fmt.Errorf("input of autoscaling run %q already exists", runName)
+	}
+	m.runInputs[runName] = append([]byte(nil), input...)
+	return nil
+}
+
+func (m *MemoryStore) InsertRunGroupMember(member RunGroupMember) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	member.Labels = append([]byte(nil), member.Labels...)
+	m.groups = append(m.groups, member)
+	return nil
+}
+
+func (m *MemoryStore) GetRunGroup(group string) ([]RunGroupMember, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var members []RunGroupMember
+	for _, member := range m.groups {
+		if member.Group == group {
+			members = append(members, member)
+		}
+	}
+	return members, nil
+}
+
+func (m *MemoryStore) GetAutoscalingRunInput(runName string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	input, ok := m.runInputs[runName]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return append([]byte(nil), input...), nil
+}
+
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+func (m *MemoryStore) findRun(name string) int {
+	for i, r := range m.runs {
+		if r.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *MemoryStore) findJob(jobId string) int {
+	for i, j := range m.training {
+		if j.JobId == jobId {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *MemoryStore) runEvents(runId string) []CloudEvent {
+	events := make([]CloudEvent, 0)
+	for _, e := range m.cloudEvents {
+		if e.RunId == runId {
+			events = append(events, e)
+		}
+	}
+	return events
+}
@@ -1,7 +1,6 @@
 package models
 
 import (
-	"database/sql"
 	"github.com/tteige/uit-go/metapipe"
 )
 
@@ -10,7 +9,7 @@ type Parameters struct {
 	JobId string
 }
 
-func InsertParameter(db *sql.DB, par Parameters) error {
+func (s *SQLStore) InsertParameter(par Parameters) error {
 
 	sqlStmt :=
 		`INSERT INTO metapipe_parameters (inputcontigscutoff, useblastuniref50, useinterproscan5, usepriam, 
@@ -19,7 +18,7 @@ func InsertParameter(db *sql.DB, par Parameters) error {
 		ON CONFLICT (jobid)
 		DO NOTHING`
 
-	_, err := db.Exec(sqlStmt, par.MP.InputContigsCutoff, par.MP.UseBlastUniref50, par.MP.UseBlastUniref50, par.MP.UsePriam,
+	_, err := s.exec(sqlStmt, par.MP.InputContigsCutoff, par.MP.UseBlastUniref50, par.MP.UseBlastUniref50, par.MP.UsePriam,
 		par.MP.RemoveNonCompleteGenes, par.MP.ExportMergedGenbank, par.MP.UseBlastMarRef, par.JobId)
 	if err != nil {
 		return err
@@ -27,13 +26,13 @@ func InsertParameter(db *sql.DB, par Parameters) error {
 	return nil
 }
 
-func GetParameters(db *sql.DB, job string) (Parameters, error) {
+func (s *SQLStore) GetParameters(job string) (Parameters, error) {
 	var par Parameters
-	err := db.QueryRow("SELECT * FROM metapipe_parameters WHERE jobid = $1", job).Scan(&par.MP.InputContigsCutoff,
+	err := s.queryRow("SELECT * FROM metapipe_parameters WHERE jobid = $1", job).Scan(&par.MP.InputContigsCutoff,
 		&par.MP.UseBlastUniref50, &par.MP.UseInterproScan5, &par.MP.UsePriam, &par.MP.RemoveNonCompleteGenes, &par.MP.ExportMergedGenbank,
 		&par.MP.UseBlastMarRef, &par.JobId)
 	if err != nil {
-		return Parameters{}, nil
+		return Parameters{}, err
 	}
 	return par, nil
 }
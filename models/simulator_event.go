@@ -2,7 +2,6 @@ package models
 
 import (
 	"time"
-	"database/sql"
 )
 
 type SimulatorEvent struct {
@@ -14,8 +13,8 @@ type SimulatorEvent struct {
 	CostAfter          float64
 }
 
-func InsertSimulatorEvent(db *sql.DB, event SimulatorEvent) error {
-	_, err := db.Exec("INSERT INTO simulator_events (run_name, queue_duration, alg_timestamp, tag, cost_before, cost_after) VALUES ($1, $2, $3, $4, $5, $6)",
+func (s *SQLStore) InsertSimulatorEvent(event SimulatorEvent) error {
+	_, err := s.exec("INSERT INTO simulator_events (run_name, queue_duration, alg_timestamp, tag, cost_before, cost_after) VALUES ($1, $2, $3, $4, $5, $6)",
 		event.RunName, event.QueueDuration, event.AlgorithmTimestamp, event.Tag, event.CostBefore, event.CostAfter)
 	if err != nil {
 		return err
@@ -23,11 +22,12 @@ func InsertSimulatorEvent(db *sql.DB, event SimulatorEvent) error {
 	return nil
 }
 
-func GetSimulatorEvents(db *sql.DB, runName string) ([]SimulatorEvent, error) {
-	rows, err := db.Query("SELECT * FROM simulator_events WHERE run_name = $1", runName)
+func (s *SQLStore) GetSimulatorEvents(runName string) ([]SimulatorEvent, error) {
+	rows, err := s.query("SELECT * FROM simulator_events WHERE run_name = $1", runName)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	var events []SimulatorEvent
 	for rows.Next() {
 		var event SimulatorEvent
@@ -38,5 +38,8 @@ func GetSimulatorEvents(db *sql.DB, runName string) ([]SimulatorEvent, error) {
 		}
 		events = append(events, event)
 	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
 	return events, nil
 }
@@ -0,0 +1,190 @@
+package models
+
+import (
+	"database/sql"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// The tables of create_database.sql, with the columns in the same order since the queries select *
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS estimator_training
+(
+  runtime       BIGINT,
+  tag           VARCHAR(255),
+  jobid         VARCHAR(255) NOT NULL PRIMARY KEY,
+  datasetsize   INTEGER,
+  queueduration BIGINT
+);
+
+CREATE TABLE IF NOT EXISTS metapipe_parameters
+(
+  inputcontigscutoff     INTEGER,
+  useblastuniref50       BOOLEAN,
+  useinterproscan5       BOOLEAN,
+  usepriam               BOOLEAN,
+  removenoncompletegenes BOOLEAN,
+  exportmergedgenbank    BOOLEAN,
+  useblastmarref         BOOLEAN,
+  jobid                  VARCHAR(255) NOT NULL PRIMARY KEY REFERENCES estimator_training (jobid)
+);
+
+CREATE TABLE IF NOT EXISTS job_attempt
+(
+  jobid     VARCHAR(255) NOT NULL,
+  attemptid VARCHAR(255) NOT NULL,
+  tag       VARCHAR(255),
+  state     VARCHAR(255),
+  submitted TIMESTAMP,
+  started   TIMESTAMP,
+  ended     TIMESTAMP,
+  PRIMARY KEY (jobid, attemptid)
+);
+
+CREATE TABLE IF NOT EXISTS autoscaling_run
+(
+  id                INTEGER PRIMARY KEY AUTOINCREMENT,
+  name              VARCHAR(255) NOT NULL UNIQUE,
+  started           TIMESTAMP,
+  finished          TIMESTAMP,
+  algorithm         VARCHAR(255),
+  algorithm_options TEXT
+);
+
+CREATE TABLE IF NOT EXISTS autoscaling_run_input
+(
+  run_name VARCHAR(255) NOT NULL PRIMARY KEY REFERENCES autoscaling_run (name),
+  input    TEXT
+);
+
+CREATE TABLE IF NOT EXISTS run_group
+(
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  group_name VARCHAR(255) NOT NULL,
+  run_name   VARCHAR(255) NOT NULL REFERENCES autoscaling_run (name),
+  labels     TEXT
+);
+
+CREATE TABLE IF NOT EXISTS cloud_events
+(
+  id             INTEGER PRIMARY KEY AUTOINCREMENT,
+  run_name       VARCHAR(255) REFERENCES autoscaling_run (name),
+  created        TIMESTAMP,
+  instance_id    VARCHAR(255),
+  type           VARCHAR(255),
+  instance_type  VARCHAR(255),
+  price          DOUBLE PRECISION,
+  instance_state VARCHAR(255),
+  cloud_name     VARCHAR(255)
+);
+
+CREATE TABLE IF NOT EXISTS simulator_events
+(
+  id             INTEGER PRIMARY KEY AUTOINCREMENT,
+  run_name       VARCHAR(255) REFERENCES autoscaling_run (name),
+  queue_duration INTEGER,
+  alg_timestamp  TIMESTAMP,
+  tag            VARCHAR(255),
+  cost_before    DOUBLE PRECISION,
+  cost_after     DOUBLE PRECISION
+);
+
+CREATE TABLE IF NOT EXISTS job_assignment
+(
+  id          INTEGER PRIMARY KEY AUTOINCREMENT,
+  run_name    VARCHAR(255) REFERENCES autoscaling_run (name),
+  jobid       VARCHAR(255),
+  attempt     INTEGER,
+  cloud       VARCHAR(255),
+  instance_id VARCHAR(255),
+  priority    INTEGER,
+  started     TIMESTAMP,
+  ended       TIMESTAMP,
+  state       VARCHAR(255)
+);
+
+CREATE TABLE IF NOT EXISTS cluster_snapshot
+(
+  id             INTEGER PRIMARY KEY AUTOINCREMENT,
+  run_name       VARCHAR(255) REFERENCES autoscaling_run (name),
+  cloud          VARCHAR(255),
+  taken          TIMESTAMP,
+  instance_limit INTEGER,
+  booting        INTEGER,
+  idle           INTEGER,
+  busy           INTEGER,
+  draining       INTEGER,
+  instance_types TEXT,
+  running_jobs   INTEGER,
+  queued_jobs    INTEGER
+);
+
+CREATE TABLE IF NOT EXISTS algorithm_job
+(
+  id            INTEGER PRIMARY KEY AUTOINCREMENT,
+  run_name      VARCHAR(255) REFERENCES autoscaling_run (name),
+  jobid         VARCHAR(255),
+  created       TIMESTAMP,
+  started       TIMESTAMP,
+  executiontime BIGINT,
+  tag           VARCHAR(255),
+  deadline      TIMESTAMP,
+  priority      INTEGER,
+  state         VARCHAR(255),
+  attempts      INTEGER DEFAULT 0,
+  processors    INTEGER DEFAULT 0,
+  memory        BIGINT DEFAULT 0,
+  instanceid    VARCHAR(255) DEFAULT ''
+);
+`
+
+// sqliteColumns are the columns added to the tables after they were first created, in the order they were added.
+// SQLite has no ADD COLUMN IF NOT EXISTS, so they are added to older database files when they are opened. The
+// columns are added at the end of the table, which keeps the column order the queries select * with
+var sqliteColumns = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	{"algorithm_job", "attempts", "INTEGER DEFAULT 0"},
+	{"algorithm_job", "processors", "INTEGER DEFAULT 0"},
+	{"algorithm_job", "memory", "BIGINT DEFAULT 0"},
+	{"algorithm_job", "instanceid", "VARCHAR(255) DEFAULT ''"},
+}
+
+// OpenSQLite opens the SQLite database file at path and creates the tables and columns that are missing.
+// The file is created if it does not exist
+func OpenSQLite(path string) (*SQLStore, error) {
+	db, err := sql.Open(sqliteDialect, path)
+	if err != nil {
+		return nil, err
+	}
+	//SQLite allows a single writer, concurrent simulations would otherwise fail with "database is locked"
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(sqliteSchema)
+	if err == nil {
+		err = addSQLiteColumns(db)
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLStore{DB: db, dialect: sqliteDialect}, nil
+}
+
+func addSQLiteColumns(db *sql.DB) error {
+	for _, c := range sqliteColumns {
+		var count int
+		err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", c.table, c.column).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		_, err = db.Exec("ALTER TABLE " + c.table + " ADD COLUMN " + c.column + " " + c.definition)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
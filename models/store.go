@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+	"github.com/tteige/uit-go/autoscale"
+)
+
+// Store is the storage of the autoscaling runs with their cloud events, simulator events, algorithm jobs,
+// job assignments and cluster snapshots, and of the estimator training data. SQLStore implements it for Postgres and SQLite and
+// MemoryStore keeps everything in memory
+type Store interface {
+	CreateAutoscalingRun(runName string, startTime time.Time, alg autoscale.AlgorithmSpec) (string, error)
+	UpdateAutoscalingRun(run string, finTime time.Time) error
+	GetAutoscalingRun(runName string) (*AutoscalingRun, error)
+	GetAllAutoscalingRunStats() ([]AutoscalingRunStats, error)
+	GetAutoscalingRunEvents(runId string) ([]CloudEvent, error)
+	InsertAutoscalingRunInput(runName string, input []byte) error
+	GetAutoscalingRunInput(runName string) ([]byte, error)
+	InsertRunGroupMember(member RunGroupMember) error
+	GetRunGroup(group string) ([]RunGroupMember, error)
+
+	WriteSimEvent(event CloudEvent) error
+	InsertSimulatorEvent(event SimulatorEvent) error
+	GetSimulatorEvents(runName string) ([]SimulatorEvent, error)
+
+	InsertAlgorithmJob(job autoscale.AlgorithmJob, runName string) error
+	GetAllAlgorithmJobs(runName string) ([]autoscale.AlgorithmJob, error)
+	InsertJobAssignment(a JobAssignment) error
+	GetJobAssignments(runName string) ([]JobAssignment, error)
+	InsertClusterSnapshot(snapshot ClusterSnapshot) error
+	GetClusterSnapshots(runName string) ([]ClusterSnapshot, error)
+
+	CheckExists(jobId string) (bool, error)
+	GetJob(jobId string) (Job, error)
+	GetAllJobs() ([]*Job, error)
+	InsertJob(job Job) error
+	UpdateJob(job Job) error
+	InsertParameter(par Parameters) error
+	GetParameters(jobId string) (Parameters, error)
+	InsertJobAttempt(attempt JobAttempt) error
+	GetAllJobAttempts() ([]JobAttempt, error)
+
+	Close() error
+}
+
+var (
+	_ Store = (*SQLStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
@@ -3,17 +3,51 @@ package simulator
 import (
 	"github.com/tteige/uit-go/autoscale"
 	"time"
-	"database/sql"
 	"github.com/tteige/uit-go/models"
-	"github.com/segmentio/ksuid"
+	"math/rand"
+	"fmt"
+	"sort"
 )
 
+// newSimCloud creates a cloud of the cluster, the ids of new instances are drawn from a random source seeded
+// with seed so the same run always creates the same instances
+func newSimCloud(cluster autoscale.Cluster, store models.Store, seed int64) *SimCloud {
+	for i := range cluster.ActiveInstances {
+		cluster.ActiveInstances[i].State = autoscale.NormalizeState(cluster.ActiveInstances[i].State)
+	}
+	if cluster.Faults != nil {
+		outages := cluster.Faults.Outages
+		sort.Slice(outages, func(i, j int) bool {
+			return outages[i].Start.Before(outages[j].Start)
+		})
+	}
+	return &SimCloud{
+		Cluster:      cluster,
+		Store:        store,
+		seed:         seed,
+		ids:          rand.New(rand.NewSource(seed)),
+		crashAt:      make(map[string]time.Time),
+		interruptAt:  make(map[string]time.Time),
+		outagesEnded: make(map[int]bool),
+	}
+}
+
 type SimCloud struct {
 	Cluster       autoscale.Cluster
-	Db            *sql.DB
+	Store         models.Store
 	runId         string
+	seed          int64
+	ids           *rand.Rand
 	lastIteration time.Time
 	beginTime     time.Time
+	// crashAt is when each running instance crashes and interruptAt when each running spot or preemptible instance
+	// is interrupted, outagesStarted counts the outages that have started and outagesEnded holds the ones that have
+	// ended, and lost are the BUSY instances lost since takeLost was last called
+	crashAt        map[string]time.Time
+	interruptAt    map[string]time.Time
+	outagesStarted int
+	outagesEnded   map[int]bool
+	lost           []string
 }
 
 func (c *SimCloud) GetExpectedJobCost(job autoscale.AlgorithmJob, instanceType string, currentTime time.Time) float64 {
@@ -23,16 +57,14 @@ func (c *SimCloud) GetExpectedJobCost(job autoscale.AlgorithmJob, instanceType s
 		sinceStart := currentTime.Sub(job.Started)
 		timeLeftOfJob = timeLeftOfJob - sinceStart
 	}
-	timeMin := float64(timeLeftOfJob / time.Minute)
-	timeHours := float64(timeMin / 60)
-	var cost float64
-	cost = float64(c.Cluster.Types[instanceType].PriceIncrement) * timeHours
-	return cost
+	//The price is integrated over the whole minutes the job runs from now, a queued job is expected to start now
+	window := timeLeftOfJob / time.Minute * time.Minute
+	return c.Cluster.Types[instanceType].Cost(currentTime, currentTime.Add(window))
 }
 
 func (c *SimCloud) SetScalingId(id string) error {
 	c.runId = id
-	sim, err := models.GetAutoscalingRun(c.Db, id)
+	sim, err := c.Store.GetAutoscalingRun(id)
 	if err != nil {
 		return err
 	}
@@ -50,66 +82,239 @@ func (c *SimCloud) GetInstanceLimit() int {
 
 func (c *SimCloud) AddInstance(instance *autoscale.Instance, currentTime time.Time) (string, error) {
 
-	eventType := "CREATED"
-	index := 0
-	for _, inst := range c.Cluster.ActiveInstances {
+	for index, inst := range c.Cluster.ActiveInstances {
 		if instance.Id == inst.Id {
-			eventType = "REUSED"
-			break
+			//Reusing a draining instance that is still running its job cancels the drain
+			if inst.State == autoscale.DRAINING && inst.TerminateAt.IsZero() {
+				err := c.transition(index, autoscale.BUSY, currentTime)
+				if err != nil {
+					return "", err
+				}
+			}
+			*instance = c.Cluster.ActiveInstances[index]
+			err := c.writeEvent(*instance, "REUSED", currentTime)
+			if err != nil {
+				return "", err
+			}
+			return instance.Id, nil
 		}
-		index++
 	}
-	instance.State = "INACTIVE"
 
 	if instance.Id == "" {
-		instance.Id = c.Cluster.Name + "_" + ksuid.New().String()
+		instance.Id = fmt.Sprintf("%s_%016x", c.Cluster.Name, c.ids.Uint64())
 	}
-	err := models.WriteSimEvent(c.Db, models.CloudEvent{
-		RunId:        c.runId,
-		Created:      currentTime,
-		Instance:     *instance,
-		InstanceType: c.Cluster.Types[instance.Type],
-		Type:         eventType,
-		CloudName:    c.Cluster.Name,
-	})
+	if c.down(currentTime) || c.outbid(instance.Type, currentTime) {
+		//The cloud is down or the spot price is too high, the request is rejected and the instance never exists
+		instance.State = autoscale.TERMINATED
+		return "", c.writeEvent(*instance, "REJECTED", currentTime)
+	}
+	instance.State = autoscale.REQUESTED
+	err := c.writeEvent(*instance, "CREATED", currentTime)
 	if err != nil {
 		return "", err
 	}
+	c.Cluster.ActiveInstances = append(c.Cluster.ActiveInstances, *instance)
+	index := len(c.Cluster.ActiveInstances) - 1
 
-	if eventType == "CREATED" {
-		c.Cluster.ActiveInstances = append(c.Cluster.ActiveInstances, *instance)
-	} else {
-		c.Cluster.ActiveInstances[index] = *instance
+	c.Cluster.ActiveInstances[index].ReadyAt = currentTime.Add(c.Cluster.Types[instance.Type].BootDuration())
+	err = c.transition(index, autoscale.BOOTING, currentTime)
+	if err != nil {
+		return "", err
+	}
+	err = c.Advance(currentTime)
+	if err != nil {
+		return "", err
+	}
+	for _, inst := range c.Cluster.ActiveInstances {
+		if inst.Id == instance.Id {
+			*instance = inst
+		}
 	}
 
 	return instance.Id, nil
 }
 
+// DeleteInstance shuts the instance down, it is TERMINATED once the shutdown time of the instance type has passed.
+// An instance that is running a job is drained instead
 func (c *SimCloud) DeleteInstance(id string, currentTime time.Time) error {
 
-	instances, err := c.GetInstances()
-	if err != nil {
-		return nil
-	}
-	for i, e := range instances {
+	for i, e := range c.Cluster.ActiveInstances {
 		if e.Id == id {
-			c.Cluster.ActiveInstances = append(instances[:i], instances[i+1:]...)
-			models.WriteSimEvent(c.Db, models.CloudEvent{
-				RunId:        c.runId,
-				Created:      currentTime,
-				Instance:     e,
-				InstanceType: c.Cluster.Types[e.Type],
-				Type:         "DELETED",
-				CloudName:    c.Cluster.Name,
-			})
-			break
+			err := c.writeEvent(e, "DELETED", currentTime)
+			if err != nil {
+				return err
+			}
+			if e.State == autoscale.BUSY {
+				return c.transition(i, autoscale.DRAINING, currentTime)
+			}
+			if e.State == autoscale.DRAINING {
+				//Already waiting for its job to finish or shutting down
+				return nil
+			}
+			return c.shutdown(i, currentTime)
+		}
+	}
+	return nil
+}
+
+// DrainInstance stops new jobs from being placed on the instance, it is shut down when the job running on it finishes
+func (c *SimCloud) DrainInstance(id string, currentTime time.Time) error {
+	for i, e := range c.Cluster.ActiveInstances {
+		if e.Id != id {
+			continue
 		}
+		if e.State == autoscale.BUSY {
+			return c.transition(i, autoscale.DRAINING, currentTime)
+		}
+		return c.DeleteInstance(id, currentTime)
 	}
 	return nil
 }
 
+// Advance moves the instances through the lifecycle states that are due at currentTime,
+// BOOTING instances become IDLE and DRAINING instances are TERMINATED
+// Instances with a fault model can also fail to boot or crash, spot and preemptible instances can be interrupted,
+// and the outages that are due start and end
+func (c *SimCloud) Advance(currentTime time.Time) error {
+	remaining := make([]autoscale.Instance, 0, len(c.Cluster.ActiveInstances))
+	for _, e := range c.Cluster.ActiveInstances {
+		if e.State == autoscale.BOOTING && !e.ReadyAt.After(currentTime) {
+			if c.bootFails(e) {
+				e.State = autoscale.TERMINATED
+				err := c.writeEvent(e, "BOOT_FAILED", e.ReadyAt)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			e.State = autoscale.IDLE
+			err := c.writeEvent(e, "TRANSITION", e.ReadyAt)
+			if err != nil {
+				return err
+			}
+			c.armCrash(e, e.ReadyAt)
+			c.armInterruption(e, e.ReadyAt)
+		}
+		if e.State == autoscale.DRAINING && !e.TerminateAt.IsZero() && !e.TerminateAt.After(currentTime) {
+			e.State = autoscale.TERMINATED
+			err := c.writeEvent(e, "TRANSITION", e.TerminateAt)
+			if err != nil {
+				return err
+			}
+			delete(c.crashAt, e.Id)
+			delete(c.interruptAt, e.Id)
+			continue
+		}
+		c.armCrash(e, currentTime)
+		c.armInterruption(e, currentTime)
+		if at, eventType, ok := c.failure(e.Id); ok && !at.After(currentTime) {
+			err := c.crash(e, eventType, at)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		remaining = append(remaining, e)
+	}
+	c.Cluster.ActiveInstances = remaining
+	return c.advanceOutages(currentTime)
+}
+
+// AcquireInstance marks an IDLE instance of the flavour as BUSY, any IDLE instance is used if the flavour is empty.
+// The id is empty if there are no IDLE instances
+func (c *SimCloud) AcquireInstance(flavour string, currentTime time.Time) (string, error) {
+	for i, e := range c.Cluster.ActiveInstances {
+		if e.State != autoscale.IDLE || (flavour != "" && flavour != e.Type) {
+			continue
+		}
+		err := c.transition(i, autoscale.BUSY, currentTime)
+		if err != nil {
+			return "", err
+		}
+		return e.Id, nil
+	}
+	return "", nil
+}
+
+// acquire marks the IDLE instance id as BUSY
+func (c *SimCloud) acquire(id string, currentTime time.Time) error {
+	for i, e := range c.Cluster.ActiveInstances {
+		if e.Id == id && e.State == autoscale.IDLE {
+			return c.transition(i, autoscale.BUSY, currentTime)
+		}
+	}
+	return fmt.Errorf("instance %s of %s is not IDLE", id, c.Cluster.Name)
+}
+
+// ReleaseInstance is called when a job of the flavour finishes on the instance id. A draining instance is shut down,
+// otherwise a BUSY instance becomes IDLE. Nothing is released if the instance is gone, it belonged to the job and
+// was lost with it. Any BUSY or draining instance of the flavour is released for a job without an instance
+func (c *SimCloud) ReleaseInstance(id string, flavour string, currentTime time.Time) (string, error) {
+	if id != "" {
+		for i, e := range c.Cluster.ActiveInstances {
+			if e.Id != id {
+				continue
+			}
+			if e.State == autoscale.DRAINING && e.TerminateAt.IsZero() {
+				return e.Id, c.shutdown(i, currentTime)
+			}
+			if e.State == autoscale.BUSY {
+				return e.Id, c.transition(i, autoscale.IDLE, currentTime)
+			}
+		}
+		return "", nil
+	}
+	index := -1
+	for i, e := range c.Cluster.ActiveInstances {
+		if flavour != "" && flavour != e.Type {
+			continue
+		}
+		if e.State == autoscale.DRAINING && e.TerminateAt.IsZero() {
+			return e.Id, c.shutdown(i, currentTime)
+		}
+		if e.State == autoscale.BUSY && index < 0 {
+			index = i
+		}
+	}
+	if index < 0 {
+		return "", nil
+	}
+	return c.Cluster.ActiveInstances[index].Id, c.transition(index, autoscale.IDLE, currentTime)
+}
+
+func (c *SimCloud) shutdown(index int, currentTime time.Time) error {
+	instance := c.Cluster.ActiveInstances[index]
+	c.Cluster.ActiveInstances[index].TerminateAt = currentTime.Add(c.Cluster.Types[instance.Type].ShutdownDuration())
+	if instance.State != autoscale.DRAINING {
+		err := c.transition(index, autoscale.DRAINING, currentTime)
+		if err != nil {
+			return err
+		}
+	}
+	return c.Advance(currentTime)
+}
+
+func (c *SimCloud) transition(index int, state string, currentTime time.Time) error {
+	c.Cluster.ActiveInstances[index].State = state
+	return c.writeEvent(c.Cluster.ActiveInstances[index], "TRANSITION", currentTime)
+}
+
+func (c *SimCloud) writeEvent(instance autoscale.Instance, eventType string, currentTime time.Time) error {
+	event := models.CloudEvent{
+		RunId:        c.runId,
+		Created:      currentTime,
+		Instance:     instance,
+		InstanceType: c.Cluster.Types[instance.Type],
+		Type:         eventType,
+		CloudName:    c.Cluster.Name,
+	}
+	return c.Store.WriteSimEvent(event)
+}
+
 func (c *SimCloud) GetInstances() ([]autoscale.Instance, error) {
-	return c.Cluster.ActiveInstances, nil
+	instances := make([]autoscale.Instance, len(c.Cluster.ActiveInstances))
+	copy(instances, c.Cluster.ActiveInstances)
+	return instances, nil
 }
 
 func (c *SimCloud) GetInstanceTypes() (map[string]autoscale.InstanceType, error) {
@@ -124,7 +329,7 @@ func (c *SimCloud) GetTotalDuration(queue []autoscale.AlgorithmJob, currentTime
 		return 0, err
 	}
 	for _, i := range instances {
-		if i.State == "ACTIVE" {
+		if i.State == autoscale.BUSY {
 			activeInstances++
 		}
 	}
@@ -0,0 +1,107 @@
+package simulator
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/segmentio/ksuid"
+	"github.com/tteige/uit-go/metapipe"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// batch is a request that starts many runs, like a Monte Carlo simulation. done is closed when all of its runs are
+// done and err is the first error of the runs
+type batch struct {
+	name string
+	done chan struct{}
+	err  error
+}
+
+// newBatch creates a batch with the name, or with a new id if the name is empty
+func newBatch(name string) batch {
+	if name == "" {
+		name = ksuid.New().String()
+	}
+	return batch{name: name, done: make(chan struct{})}
+}
+
+// wait blocks until the batch is done and returns its error
+func (b *batch) wait() error {
+	<-b.done
+	return b.err
+}
+
+// batchInput fills in the defaults of the request the runs of a batch are made from, so every run gets the same
+// clusters, seed and period. A run of a batch is a single simulation
+func (sim *Simulator) batchInput(input metapipe.ScalingRequestInput) metapipe.ScalingRequestInput {
+	if input.Clusters == nil {
+		input.Clusters = sim.SimClusters
+	}
+	if input.Seed == 0 {
+		input.Seed = time.Now().UnixNano()
+	}
+	if input.Timestep == 0 {
+		input.Timestep = 30
+	}
+	if input.Iterations == 0 {
+		input.Iterations = 96
+	}
+	input.Compare = nil
+	input.MonteCarloRuns = 0
+	return input
+}
+
+// startRuns starts the runs, the returned function waits for all of them and returns the first error
+func (sim *Simulator) startRuns(runs []metapipeReturn) func() error {
+	results := make([]<-chan runResult, 0, len(runs))
+	for _, run := range runs {
+		results = append(results, sim.runs().start(run))
+	}
+	return func() error {
+		var err error
+		for _, result := range results {
+			res := <-result
+			if res.err != nil && err == nil {
+				err = res.err
+			}
+		}
+		return err
+	}
+}
+
+// acceptBatch logs when the batch is done and answers the request that started it with 202 Accepted, the location
+// of the batch under path and its status. kind names the batch in the log
+func (sim *Simulator) acceptBatch(w http.ResponseWriter, kind string, path string, b *batch, status interface{}) {
+	go func() {
+		err := b.wait()
+		if err != nil {
+			sim.Log.Printf("Stopped %s %s: %s", kind, b.name, err)
+			return
+		}
+		sim.Log.Printf("FINISHED %s %s", strings.ToUpper(kind), b.name)
+	}()
+
+	w.Header().Set("Location", path+url.PathEscape(b.name))
+	w.WriteHeader(http.StatusAccepted)
+	enc := json.NewEncoder(w)
+	enc.Encode(status)
+}
+
+// batchStatusHandle returns a handler that reports the status of the batch named in the path, status returns
+// false if the manager does not know the batch
+func (sim *Simulator) batchStatusHandle(kind string, status func(name string) (interface{}, bool)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["name"]
+		sim.Log.Printf("StatusRequest: %s", r.URL.Path)
+
+		s, ok := status(name)
+		if !ok {
+			http.Error(w, "unknown "+kind+" "+name, http.StatusNotFound)
+			return
+		}
+		enc := json.NewEncoder(w)
+		enc.Encode(s)
+	}
+}
@@ -0,0 +1,225 @@
+package simulator
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/tteige/uit-go/autoscale"
+	"github.com/tteige/uit-go/models"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// InstanceBill is what an instance cost in a run. The instance is up from it was created, or from the run
+// started, until it was terminated or the run ended. The billed time is the up time under the billing model of
+// its instance type, the idle cost is the price of the time it was IDLE. The times are in hours
+type InstanceBill struct {
+	InstanceId  string    `json:"instance_id"`
+	Cloud       string    `json:"cloud"`
+	Type        string    `json:"type"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	UpHours     float64   `json:"up_hours"`
+	IdleHours   float64   `json:"idle_hours"`
+	BilledHours float64   `json:"billed_hours"`
+	Cost        float64   `json:"cost"`
+	IdleCost    float64   `json:"idle_cost"`
+}
+
+// CloudBill is the sum of the bills of the instances of a cloud
+type CloudBill struct {
+	Instances         int     `json:"instances"`
+	InstanceHours     float64 `json:"instance_hours"`
+	IdleInstanceHours float64 `json:"idle_instance_hours"`
+	BilledHours       float64 `json:"billed_hours"`
+	Cost              float64 `json:"cost"`
+	IdleCost          float64 `json:"idle_cost"`
+}
+
+// Bill is the billed cost of a run for each instance, for each cloud and in total
+type Bill struct {
+	Cost      float64              `json:"cost"`
+	IdleCost  float64              `json:"idle_cost"`
+	Clouds    map[string]CloudBill `json:"clouds"`
+	Instances []InstanceBill       `json:"instances"`
+}
+
+// billRun replays the cloud events of a run and bills every instance under the billing model and prices of its
+// instance type in the clusters of the run. The clouds of the events are the names of the clusters. The instances
+// of the clusters are up from the start of the run, also if they never change. Events at the same time are replayed
+// in the order they were stored. The time an instance is billed for beyond its up time is priced at the price it
+// had when it went down
+func billRun(clusters autoscale.ClusterCollection, events []models.CloudEvent, start time.Time, end time.Time) Bill {
+	type instance struct {
+		bill     InstanceBill
+		state    string
+		since    time.Time
+		t        autoscale.InstanceType
+		up       time.Duration
+		idle     time.Duration
+		cost     float64
+		idleCost float64
+	}
+	types := make(map[string]autoscale.InstanceType)
+	for _, cluster := range clusters {
+		for name, t := range cluster.Types {
+			types[cluster.Name+"/"+name] = t
+		}
+	}
+	sorted := append([]models.CloudEvent(nil), events...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].Created.Equal(sorted[j].Created) {
+			return sorted[i].Created.Before(sorted[j].Created)
+		}
+		return sorted[i].Id < sorted[j].Id
+	})
+
+	//Advance the instance to until, counting the time since the last event as up and maybe idle
+	advance := func(i *instance, until time.Time) {
+		if until.After(end) {
+			until = end
+		}
+		if !until.After(i.since) {
+			return
+		}
+		d := until.Sub(i.since)
+		cost := i.t.Cost(i.since, until)
+		i.up += d
+		i.cost += cost
+		if i.state == autoscale.IDLE {
+			i.idle += d
+			i.idleCost += cost
+		}
+		i.since = until
+	}
+
+	var done []*instance
+	active := make(map[string]*instance)
+	for _, cluster := range clusters {
+		for _, e := range cluster.ActiveInstances {
+			state := autoscale.NormalizeState(e.State)
+			if e.Id == "" || state == autoscale.TERMINATED {
+				continue
+			}
+			active[e.Id] = &instance{
+				bill: InstanceBill{
+					InstanceId: e.Id,
+					Cloud:      cluster.Name,
+					Type:       e.Type,
+					Start:      start,
+				},
+				state: state,
+				since: start,
+				t:     types[cluster.Name+"/"+e.Type],
+			}
+		}
+	}
+	for _, e := range sorted {
+		if e.Instance.Id == "" || e.Type == "REJECTED" {
+			continue
+		}
+		i, ok := active[e.Instance.Id]
+		if !ok {
+			t, known := types[e.CloudName+"/"+e.Instance.Type]
+			if !known {
+				t = autoscale.InstanceType{PriceIncrement: e.InstanceType.PriceIncrement}
+			}
+			i = &instance{
+				bill: InstanceBill{
+					InstanceId: e.Instance.Id,
+					Cloud:      e.CloudName,
+					Type:       e.Instance.Type,
+					Start:      e.Created,
+				},
+				since: e.Created,
+				t:     t,
+			}
+			//The instance existed before the run, it is billed from the start of the run
+			if e.Type != "CREATED" {
+				i.bill.Start = start
+				i.since = start
+				i.state = autoscale.NormalizeState(e.Instance.State)
+			}
+			active[e.Instance.Id] = i
+		}
+		advance(i, e.Created)
+		i.state = e.Instance.State
+		if i.state == autoscale.TERMINATED {
+			i.bill.End = i.since
+			delete(active, e.Instance.Id)
+			done = append(done, i)
+		}
+	}
+	for _, i := range active {
+		advance(i, end)
+		i.bill.End = end
+		done = append(done, i)
+	}
+
+	bill := Bill{Clouds: make(map[string]CloudBill)}
+	for _, i := range done {
+		billed := i.t.Billing.BilledDuration(i.up)
+		i.bill.UpHours = i.up.Hours()
+		i.bill.IdleHours = i.idle.Hours()
+		i.bill.BilledHours = billed.Hours()
+		i.bill.Cost = i.cost + (billed-i.up).Hours()*i.t.PriceAt(i.bill.End)
+		i.bill.IdleCost = i.idleCost
+		bill.Instances = append(bill.Instances, i.bill)
+	}
+	sort.Slice(bill.Instances, func(a, b int) bool {
+		x, y := bill.Instances[a], bill.Instances[b]
+		if x.Cloud != y.Cloud {
+			return x.Cloud < y.Cloud
+		}
+		if !x.Start.Equal(y.Start) {
+			return x.Start.Before(y.Start)
+		}
+		return x.InstanceId < y.InstanceId
+	})
+	for _, i := range bill.Instances {
+		c := bill.Clouds[i.Cloud]
+		c.Instances++
+		c.InstanceHours += i.UpHours
+		c.IdleInstanceHours += i.IdleHours
+		c.BilledHours += i.BilledHours
+		c.Cost += i.Cost
+		c.IdleCost += i.IdleCost
+		bill.Clouds[i.Cloud] = c
+		bill.Cost += i.Cost
+		bill.IdleCost += i.IdleCost
+	}
+	return bill
+}
+
+// runBill reads the input and cloud events of a finished run and bills it
+func (sim *Simulator) runBill(id string) (Bill, error) {
+	in, err := sim.runInput(id)
+	if err != nil {
+		return Bill{}, err
+	}
+	events, err := sim.Store.GetAutoscalingRunEvents(id)
+	if err != nil && err != sql.ErrNoRows {
+		return Bill{}, err
+	}
+	return billRun(in.Clusters, events, in.StartTime, in.end()), nil
+}
+
+// billHandle writes the billed cost of a run for each instance and cloud
+func (sim *Simulator) billHandle(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	sim.Log.Printf("BillRequest: /metapipe/simulation/%s/bill", id)
+
+	if _, err := sim.Store.GetAutoscalingRunInput(id); err != nil {
+		http.Error(w, "no stored input for simulation "+id, http.StatusNotFound)
+		return
+	}
+	bill, err := sim.runBill(id)
+	if err != nil {
+		sim.Log.Print(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	enc := json.NewEncoder(w)
+	enc.Encode(&bill)
+}
@@ -0,0 +1,106 @@
+package simulator
+
+import (
+	"github.com/tteige/uit-go/autoscale"
+	"github.com/tteige/uit-go/models"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBillRun(t *testing.T) {
+	start := time.Date(2017, 11, 24, 0, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time {
+		return start.Add(time.Duration(minutes) * time.Minute)
+	}
+	clusters := autoscale.ClusterCollection{
+		"aws": {
+			Name: "aws",
+			Types: map[string]autoscale.InstanceType{
+				"default": {Name: "default", PriceIncrement: 1, Billing: autoscale.BillingModel{Granularity: 3600}},
+				"second":  {Name: "second", PriceIncrement: 2},
+			},
+			ActiveInstances: []autoscale.Instance{
+				{Id: "pre", Type: "default", State: autoscale.INACTIVE},
+				{Id: "gone", Type: "default", State: autoscale.TERMINATED},
+			},
+		},
+	}
+	event := func(id int, minutes int, instance string, instanceType string, eventType string, state string) models.CloudEvent {
+		return models.CloudEvent{
+			Id:        id,
+			Created:   at(minutes),
+			Instance:  autoscale.Instance{Id: instance, Type: instanceType, State: state},
+			Type:      eventType,
+			CloudName: "aws",
+		}
+	}
+	events := []models.CloudEvent{
+		event(1, 60, "new", "default", "CREATED", autoscale.BOOTING),
+		event(2, 90, "new", "default", "READY", autoscale.IDLE),
+		event(3, 120, "new", "default", "BUSY", autoscale.BUSY),
+		event(4, 195, "new", "default", "TERMINATED", autoscale.TERMINATED),
+		//An instance that existed before the run is billed from the start
+		event(5, 240, "old", "second", "IDLE", autoscale.IDLE),
+		//Events at the same time are replayed in the order they were stored
+		event(8, 300, "late", "default", "TERMINATED", autoscale.TERMINATED),
+		event(7, 300, "late", "default", "CREATED", autoscale.BOOTING),
+		event(9, 360, "", "default", "REJECTED", ""),
+	}
+	bill := billRun(clusters, events, start, at(600))
+
+	want := []InstanceBill{
+		{InstanceId: "old", Cloud: "aws", Type: "second", Start: start, End: at(600), UpHours: 10, IdleHours: 10, BilledHours: 10, Cost: 20, IdleCost: 20},
+		{InstanceId: "pre", Cloud: "aws", Type: "default", Start: start, End: at(600), UpHours: 10, IdleHours: 10, BilledHours: 10, Cost: 10, IdleCost: 10},
+		{InstanceId: "new", Cloud: "aws", Type: "default", Start: at(60), End: at(195), UpHours: 2.25, IdleHours: 0.5, BilledHours: 3, Cost: 3, IdleCost: 0.5},
+		{InstanceId: "late", Cloud: "aws", Type: "default", Start: at(300), End: at(300)},
+	}
+	if len(bill.Instances) != len(want) {
+		t.Fatalf("got %d instances, want %d: %v", len(bill.Instances), len(want), bill.Instances)
+	}
+	for i, w := range want {
+		got := bill.Instances[i]
+		if got.InstanceId != w.InstanceId || got.Cloud != w.Cloud || got.Type != w.Type || !got.Start.Equal(w.Start) || !got.End.Equal(w.End) ||
+			!near(got.UpHours, w.UpHours) || !near(got.IdleHours, w.IdleHours) || !near(got.BilledHours, w.BilledHours) ||
+			!near(got.Cost, w.Cost) || !near(got.IdleCost, w.IdleCost) {
+			t.Errorf("instance %d is %+v, want %+v", i, got, w)
+		}
+	}
+	cloud := bill.Clouds["aws"]
+	if cloud.Instances != 4 || !near(cloud.Cost, 33) || !near(cloud.IdleCost, 30.5) || !near(cloud.BilledHours, 23) {
+		t.Errorf("cloud bill is %+v", cloud)
+	}
+	if !near(bill.Cost, 33) || !near(bill.IdleCost, 30.5) {
+		t.Errorf("bill cost is %v and idle cost %v, want 33 and 30.5", bill.Cost, bill.IdleCost)
+	}
+}
+
+func TestBillRunPriceChange(t *testing.T) {
+	start := time.Date(2017, 11, 24, 0, 0, 0, 0, time.UTC)
+	clusters := autoscale.ClusterCollection{
+		"spot": {
+			Name: "spot",
+			Types: map[string]autoscale.InstanceType{
+				"default": {
+					Name:           "default",
+					PriceIncrement: 1,
+					Billing:        autoscale.BillingModel{Granularity: 3600},
+					Prices:         []autoscale.PricePoint{{Time: start.Add(30 * time.Minute), Price: 3}},
+				},
+			},
+		},
+	}
+	events := []models.CloudEvent{
+		{Id: 1, Created: start, Instance: autoscale.Instance{Id: "a", Type: "default", State: autoscale.IDLE}, Type: "CREATED", CloudName: "spot"},
+		{Id: 2, Created: start.Add(45 * time.Minute), Instance: autoscale.Instance{Id: "a", Type: "default", State: autoscale.TERMINATED}, Type: "TERMINATED", CloudName: "spot"},
+	}
+	bill := billRun(clusters, events, start, start.Add(2*time.Hour))
+	//Half an hour at 1 and a quarter at 3, the billed quarter after it went down is priced at 3
+	if want := 0.5 + 0.75 + 0.75; !near(bill.Cost, want) {
+		t.Errorf("cost is %v, want %v", bill.Cost, want)
+	}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
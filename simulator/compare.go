@@ -0,0 +1,237 @@
+package simulator
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/tteige/uit-go/autoscale"
+	"github.com/tteige/uit-go/metapipe"
+	"net/http"
+	"time"
+)
+
+// AlgorithmReport is the outcome of one algorithm of a comparison for each cloud and for all clouds together
+type AlgorithmReport struct {
+	Algorithm autoscale.AlgorithmSpec `json:"algorithm"`
+	Run       string                  `json:"run"`
+	Clouds    map[string]CloudMetrics `json:"clouds"`
+	Total     CloudMetrics            `json:"total"`
+}
+
+// ComparisonReport compares algorithms that ran on the same jobs, clusters and seed
+type ComparisonReport struct {
+	Name       string            `json:"name"`
+	Seed       int64             `json:"seed"`
+	Clouds     []string          `json:"clouds"`
+	Algorithms []AlgorithmReport `json:"algorithms"`
+}
+
+// ComparisonStatus is the state of every run of a comparison, the report is set when all are finished
+type ComparisonStatus struct {
+	Name   string            `json:"name"`
+	State  string            `json:"state"`
+	Runs   []RunStatus       `json:"runs"`
+	Report *ComparisonReport `json:"report,omitempty"`
+	Error  string            `json:"error,omitempty"`
+}
+
+type comparison struct {
+	batch
+	seed   int64
+	specs  []autoscale.AlgorithmSpec
+	runs   []metapipeReturn
+	report *ComparisonReport
+}
+
+// Compare runs the simulation request once with every algorithm of Compare and waits for the report
+func (sim *Simulator) Compare(input metapipe.ScalingRequestInput) (ComparisonReport, error) {
+	c, err := sim.startComparison(input)
+	if err != nil {
+		return ComparisonReport{}, err
+	}
+	err = c.wait()
+	if err != nil {
+		return ComparisonReport{}, err
+	}
+	return *c.report, nil
+}
+
+// startComparison starts a run for every algorithm of the request. The jobs are loaded once and every run gets
+// the same clusters and seed, so the algorithms are the only difference between the runs
+func (sim *Simulator) startComparison(input metapipe.ScalingRequestInput) (*comparison, error) {
+	if len(input.Compare) < 1 {
+		return nil, invalidRequest(fmt.Errorf("a comparison needs at least one algorithm"))
+	}
+	specs := input.Compare
+	input = sim.batchInput(input)
+	c := &comparison{
+		batch: newBatch(input.Name),
+		seed:  input.Seed,
+		specs: specs,
+	}
+
+	jobs, err := sim.loadJobs(input)
+	if err != nil {
+		return nil, err
+	}
+	for i := range c.specs {
+		spec := c.specs[i]
+		runInput := input
+		runInput.Name = fmt.Sprintf("%s-%d-%s", c.name, i+1, spec.Name)
+		runInput.Algorithm = &spec
+		run := sim.prepareRunWithJobs(runInput, jobs)
+		if run.err != nil {
+			return nil, run.err
+		}
+		c.runs = append(c.runs, run)
+	}
+
+	wait := sim.startRuns(c.runs)
+	sim.runs().addComparison(c)
+	go func() {
+		defer close(c.done)
+		c.err = wait()
+		if c.err != nil {
+			return
+		}
+		report, err := sim.comparisonReport(c)
+		c.report = &report
+		c.err = err
+	}()
+	return c, nil
+}
+
+func (sim *Simulator) comparisonReport(c *comparison) (ComparisonReport, error) {
+	report := ComparisonReport{
+		Name: c.name,
+		Seed: c.seed,
+	}
+	for i, run := range c.runs {
+		clouds, total, err := sim.runMetrics(run.id)
+		if err != nil {
+			return report, err
+		}
+		report.Algorithms = append(report.Algorithms, AlgorithmReport{
+			Algorithm: c.specs[i],
+			Run:       run.id,
+			Clouds:    clouds,
+			Total:     total,
+		})
+		if i == 0 {
+			report.Clouds = run.input.Clouds.Names()
+		}
+	}
+	return report, nil
+}
+
+// compareHandle starts a comparison, its runs and report are polled at the returned location
+func (sim *Simulator) compareHandle(w http.ResponseWriter, reqInput metapipe.ScalingRequestInput) {
+	c, err := sim.startComparison(reqInput)
+	if err != nil {
+		sim.Log.Print(err)
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	status := sim.comparisonStatus(c)
+	sim.acceptBatch(w, "comparison", "/metapipe/comparison/", &c.batch, &status)
+}
+
+// comparisonStatusHandle reports the runs of a comparison, and the report when they are all finished
+func (sim *Simulator) comparisonStatusHandle() http.HandlerFunc {
+	return sim.batchStatusHandle("comparison", func(name string) (interface{}, bool) {
+		c, ok := sim.runs().comparison(name)
+		if !ok {
+			return nil, false
+		}
+		status := sim.comparisonStatus(c)
+		return &status, true
+	})
+}
+
+// comparisonPageHandle renders the report of a comparison side by side, the page reloads until it is done
+func (sim *Simulator) comparisonPageHandle(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	sim.Log.Printf("ComparisonPageRequest: /comparison/%s", name)
+
+	c, ok := sim.runs().comparison(name)
+	if !ok {
+		http.Error(w, "unknown comparison "+name, http.StatusNotFound)
+		return
+	}
+	err := sim.renderTemplate(w, "comparison", newComparisonPage(sim.comparisonStatus(c)))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// comparisonPage is a table of the algorithms for each cloud and one for all clouds, with the times in hours
+// and minutes
+type comparisonPage struct {
+	Status ComparisonStatus
+	Tables []comparisonTable
+}
+
+type comparisonTable struct {
+	Cloud string
+	Rows  []comparisonRow
+}
+
+type comparisonRow struct {
+	Algorithm       string
+	Run             string
+	Metrics         CloudMetrics
+	MakespanHours   float64
+	MeanWaitMinutes float64
+	P95WaitMinutes  float64
+}
+
+func newComparisonPage(status ComparisonStatus) comparisonPage {
+	page := comparisonPage{Status: status}
+	if status.Report == nil {
+		return page
+	}
+	row := func(a AlgorithmReport, m CloudMetrics) comparisonRow {
+		return comparisonRow{
+			Algorithm:       a.Algorithm.Name,
+			Run:             a.Run,
+			Metrics:         m,
+			MakespanHours:   float64(m.Makespan) / float64(time.Hour/time.Millisecond),
+			MeanWaitMinutes: m.MeanWait / float64(time.Minute/time.Millisecond),
+			P95WaitMinutes:  m.P95Wait / float64(time.Minute/time.Millisecond),
+		}
+	}
+	total := comparisonTable{Cloud: "All clouds"}
+	for _, a := range status.Report.Algorithms {
+		total.Rows = append(total.Rows, row(a, a.Total))
+	}
+	page.Tables = append(page.Tables, total)
+	for _, cloud := range status.Report.Clouds {
+		table := comparisonTable{Cloud: cloud}
+		for _, a := range status.Report.Algorithms {
+			table.Rows = append(table.Rows, row(a, a.Clouds[cloud]))
+		}
+		page.Tables = append(page.Tables, table)
+	}
+	return page
+}
+
+func (sim *Simulator) comparisonStatus(c *comparison) ComparisonStatus {
+	status := ComparisonStatus{
+		Name:  c.name,
+		State: RunRunning,
+	}
+	for _, run := range c.runs {
+		s, _ := sim.runStatus(run.id)
+		status.Runs = append(status.Runs, s)
+	}
+	select {
+	case <-c.done:
+		status.State = RunFinished
+		status.Report = c.report
+		if c.err != nil {
+			status.State = RunFailed
+			status.Error = c.err.Error()
+		}
+	default:
+	}
+	return status
+}
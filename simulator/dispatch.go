@@ -0,0 +1,86 @@
+package simulator
+
+import (
+	"github.com/tteige/uit-go/autoscale"
+	"time"
+)
+
+// startJobs lets the dispatcher choose the waiting jobs of the cloud key in the queue that start now, and starts
+// them on the instances it chose. The indexes of the started jobs in the queue are returned in start order
+func startJobs(d autoscale.Dispatcher, cloud *SimCloud, key string, queue []autoscale.AlgorithmJob, now time.Time) ([]int, error) {
+	instances, err := cloud.GetInstances()
+	if err != nil {
+		return nil, err
+	}
+	input := autoscale.DispatchInput{Instances: instances, Now: now}
+	var waiting []int
+	for i, j := range queue {
+		if j.Tag != key {
+			continue
+		}
+		if j.State == autoscale.RUNNING {
+			input.Running = append(input.Running, j)
+		} else {
+			waiting = append(waiting, i)
+			input.Waiting = append(input.Waiting, j)
+		}
+	}
+	if len(waiting) == 0 {
+		return nil, nil
+	}
+	input.Free = freeInstances(instances, input.Running)
+
+	var started []int
+	for _, p := range d.Dispatch(input) {
+		index := waiting[p.Job]
+		instance := input.Free[p.Instance]
+		if instance.State == autoscale.IDLE {
+			err = cloud.acquire(instance.Id, now)
+			if err != nil {
+				return nil, err
+			}
+		}
+		queue[index].State = autoscale.RUNNING
+		queue[index].Started = now
+		queue[index].InstanceId = instance.Id
+		started = append(started, index)
+	}
+	return started, nil
+}
+
+// freeInstances are the instances that can take a job. Instances that were BUSY when the simulation started
+// without a running job come first, then the IDLE instances. Booting instances can not run jobs yet, draining
+// instances only run the job they already have
+func freeInstances(instances []autoscale.Instance, running []autoscale.AlgorithmJob) []autoscale.Instance {
+	assigned := make(map[string]int)
+	for _, j := range running {
+		assigned[j.InstanceId]++
+	}
+	busy := 0
+	var free []autoscale.Instance
+	for _, i := range instances {
+		if i.State != autoscale.BUSY && (i.State != autoscale.DRAINING || !i.TerminateAt.IsZero()) {
+			continue
+		}
+		busy++
+		if assigned[i.Id] > 0 {
+			assigned[i.Id]--
+			continue
+		}
+		free = append(free, i)
+	}
+	//Running jobs on an unknown instance take one of the unassigned instances each
+	slots := busy - len(running)
+	if slots < 0 {
+		slots = 0
+	}
+	if len(free) > slots {
+		free = free[:slots]
+	}
+	for _, i := range instances {
+		if i.State == autoscale.IDLE {
+			free = append(free, i)
+		}
+	}
+	return free
+}
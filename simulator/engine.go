@@ -0,0 +1,443 @@
+package simulator
+
+import (
+	"container/heap"
+	"github.com/tteige/uit-go/autoscale"
+	"github.com/tteige/uit-go/models"
+	"strconv"
+	"time"
+)
+
+// Event types of the discrete event engine, events at the same time are processed in this order
+const (
+	jobCompletion = iota
+	instanceReady
+	jobArrival
+	algorithmTick
+)
+
+type engineEvent struct {
+	time  time.Time
+	kind  int
+	seq   int
+	job   autoscale.AlgorithmJob
+	cloud string
+	tick  int
+}
+
+type eventQueue []engineEvent
+
+func (q eventQueue) Len() int {
+	return len(q)
+}
+
+func (q eventQueue) Less(i, j int) bool {
+	if !q[i].time.Equal(q[j].time) {
+		return q[i].time.Before(q[j].time)
+	}
+	if q[i].kind != q[j].kind {
+		return q[i].kind < q[j].kind
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q eventQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+}
+
+func (q *eventQueue) Push(x interface{}) {
+	*q = append(*q, x.(engineEvent))
+}
+
+func (q *eventQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	ev := old[n-1]
+	*q = old[:n-1]
+	return ev
+}
+
+// engine is the discrete event simulation of a single run. Jobs start as soon as an instance is IDLE and finish
+// exactly when their execution time has passed, the algorithm is still run every timestep minutes
+type engine struct {
+	sim       *Simulator
+	run       metapipeReturn
+	events    eventQueue
+	seq       int
+	now       time.Time
+	queue     []autoscale.AlgorithmJob
+	output    simulationOutput
+	scheduled map[string]bool
+	// stale are the attempts of jobs that were lost to a crashed instance, their completions are ignored
+	stale map[string]bool
+}
+
+func (sim *Simulator) simulateEvents(run metapipeReturn) (simulationOutput, error) {
+	e := &engine{
+		sim:       sim,
+		run:       run,
+		now:       run.timestamp,
+		queue:     run.input.JobQueue,
+		output:    make(simulationOutput),
+		scheduled: make(map[string]bool),
+		stale:     make(map[string]bool),
+	}
+
+	for _, job := range run.jobs {
+		arrival := job.Created
+		if arrival.Before(run.timestamp) {
+			arrival = run.timestamp
+		}
+		e.push(engineEvent{time: arrival, kind: jobArrival, job: job})
+	}
+	//Only the next algorithm tick is queued, each tick queues the one after it
+	end := e.tickTime(run.iterations - 1)
+	if run.iterations > 0 {
+		e.push(engineEvent{time: run.timestamp, kind: algorithmTick, tick: 0})
+	}
+
+	for e.events.Len() > 0 {
+		if err := run.ctx.Err(); err != nil {
+			return nil, err
+		}
+		ev := heap.Pop(&e.events).(engineEvent)
+		if ev.time.After(end) {
+			break
+		}
+		e.now = ev.time
+		var err error
+		switch ev.kind {
+		case jobArrival:
+			err = e.arrive(ev.job)
+		case jobCompletion:
+			err = e.complete(ev.job, ev.cloud)
+		case instanceReady:
+			err = e.instanceChanged(ev.cloud)
+		case algorithmTick:
+			err = e.tick(ev.tick)
+		}
+		if err != nil {
+			return nil, err
+		}
+		err = e.recoverLostJobs()
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, job := range e.queue {
+		err := sim.recordJob(run, job, end)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return e.output, nil
+}
+
+func (e *engine) tickTime(iteration int) time.Time {
+	return e.run.timestamp.Add(time.Minute * time.Duration(e.run.timestep*iteration))
+}
+
+func (e *engine) push(ev engineEvent) {
+	ev.seq = e.seq
+	e.seq++
+	heap.Push(&e.events, ev)
+}
+
+func (e *engine) simCloud(key string) (*SimCloud, bool) {
+	cloud, ok := e.run.input.Clouds[key].(*SimCloud)
+	return cloud, ok
+}
+
+func (e *engine) arrive(job autoscale.AlgorithmJob) error {
+	if job.State == autoscale.RUNNING {
+		//The job was running before the simulation started, it needs an instance even if none is BUSY
+		if cloud, ok := e.simCloud(job.Tag); ok {
+			idle, busy, running, err := e.usage(job.Tag)
+			if err != nil {
+				return err
+			}
+			if busy <= running && idle > 0 {
+				job.InstanceId, err = cloud.AcquireInstance("", e.now)
+				if err != nil {
+					return err
+				}
+			} else {
+				job.InstanceId = unassignedInstance(cloud, e.queue)
+			}
+		}
+		e.queue = append(e.queue, job)
+		e.scheduleCompletion(job)
+		return nil
+	}
+	e.queue = append(e.queue, job)
+	return e.dispatch(job.Tag)
+}
+
+func (e *engine) complete(job autoscale.AlgorithmJob, key string) error {
+	if e.stale[attemptKey(job)] {
+		delete(e.stale, attemptKey(job))
+		return nil
+	}
+	for i := range e.queue {
+		if e.queue[i].Id == job.Id && e.queue[i].State == autoscale.RUNNING {
+			finished := e.queue[i]
+			finished.State = autoscale.FINISHED
+			err := e.sim.recordJob(e.run, finished, e.now)
+			if err != nil {
+				return err
+			}
+			e.queue = append(e.queue[:i], e.queue[i+1:]...)
+			break
+		}
+	}
+	cloud, ok := e.simCloud(key)
+	if !ok {
+		return nil
+	}
+	id, err := cloud.ReleaseInstance(job.InstanceId, job.InstanceFlavour, e.now)
+	if err != nil {
+		return err
+	}
+	if id == "" {
+		e.sim.Log.Println("Something went wrong with the simulation of job state transition. No busy instances found")
+	}
+	e.scheduleInstanceEvents(key)
+	return e.dispatch(key)
+}
+
+func (e *engine) instanceChanged(key string) error {
+	cloud, ok := e.simCloud(key)
+	if !ok {
+		return nil
+	}
+	err := cloud.Advance(e.now)
+	if err != nil {
+		return err
+	}
+	return e.dispatch(key)
+}
+
+func (e *engine) tick(iteration int) error {
+	clouds := e.run.input.Clouds
+	for _, key := range clouds.Names() {
+		if cloud, ok := e.simCloud(key); ok {
+			err := cloud.Advance(e.now)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	totalCostBeforeMap := make(map[string]float64)
+	queueMap := splitByTag(e.queue)
+	for _, key := range autoscale.SortedTags(queueMap) {
+		if cloud, ok := clouds[key]; ok {
+			totalCostBeforeMap[key] = cloud.GetTotalCost(queueMap[key], e.now)
+		}
+	}
+
+	out, err := e.run.algorithm.Run(autoscale.AlgorithmInput{JobQueue: e.queue, Clouds: clouds}, e.now)
+	if err != nil {
+		return err
+	}
+	out.Instances, err = autoscale.ApplyActions(clouds, out.Actions, e.now)
+	if err != nil {
+		return err
+	}
+	e.queue = out.JobQueue
+
+	for _, key := range clouds.Names() {
+		e.scheduleInstanceEvents(key)
+		err = e.dispatch(key)
+		if err != nil {
+			return err
+		}
+	}
+
+	resp := make(map[string][]autoscale.AlgorithmJob)
+	queueMap = splitByTag(e.queue)
+	for _, key := range autoscale.SortedTags(queueMap) {
+		queue := queueMap[key]
+		cloud, ok := clouds[key]
+		if !ok {
+			continue
+		}
+		dur, err := cloud.GetTotalDuration(queue, e.now)
+		if err != nil {
+			return err
+		}
+		err = e.sim.insertSimulatorEvent(e.run, models.SimulatorEvent{
+			RunName:            e.run.id,
+			QueueDuration:      dur,
+			AlgorithmTimestamp: e.now,
+			Tag:                key,
+			CostBefore:         totalCostBeforeMap[key],
+			CostAfter:          cloud.GetTotalCost(queue, e.now),
+		})
+		if err != nil {
+			return err
+		}
+		resp[key] = queue
+	}
+	err = e.sim.recordSnapshots(e.run, clouds, e.queue, e.now)
+	if err != nil {
+		return err
+	}
+	e.output[iteration] = resp
+	e.run.progress(iteration + 1)
+	if iteration+1 < e.run.iterations {
+		e.push(engineEvent{time: e.tickTime(iteration + 1), kind: algorithmTick, tick: iteration + 1})
+	}
+	return nil
+}
+
+// dispatch starts the queued jobs of the cloud that the dispatcher of the run chooses
+func (e *engine) dispatch(key string) error {
+	cloud, ok := e.simCloud(key)
+	if !ok {
+		return nil
+	}
+	started, err := startJobs(e.run.dispatcher, cloud, key, e.queue, e.now)
+	if err != nil {
+		return err
+	}
+	for _, index := range started {
+		e.scheduleCompletion(e.queue[index])
+	}
+	return nil
+}
+
+// usage counts the IDLE and BUSY instances of the cloud and the jobs running on it.
+// Booting instances can not run jobs yet, draining instances only run the job they already have
+func (e *engine) usage(key string) (int, int, int, error) {
+	cloud, ok := e.simCloud(key)
+	if !ok {
+		return 0, 0, 0, nil
+	}
+	instances, err := cloud.GetInstances()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	idle := 0
+	busy := 0
+	for _, i := range instances {
+		switch i.State {
+		case autoscale.IDLE:
+			idle++
+		case autoscale.BUSY:
+			busy++
+		case autoscale.DRAINING:
+			if i.TerminateAt.IsZero() {
+				busy++
+			}
+		}
+	}
+	running := 0
+	for _, j := range e.queue {
+		if j.Tag == key && j.State == autoscale.RUNNING {
+			running++
+		}
+	}
+	return idle, busy, running, nil
+}
+
+func (e *engine) scheduleCompletion(job autoscale.AlgorithmJob) {
+	finish := job.Started.Add(time.Millisecond * time.Duration(e.run.noise.executionTime(job)))
+	if finish.Before(e.now) {
+		finish = e.now
+	}
+	e.push(engineEvent{time: finish, kind: jobCompletion, job: job, cloud: job.Tag})
+}
+
+// recoverLostJobs requeues the jobs of instances that crashed and schedules the coming faults of every cloud
+func (e *engine) recoverLostJobs() error {
+	for _, key := range e.run.input.Clouds.Names() {
+		cloud, ok := e.simCloud(key)
+		if !ok {
+			continue
+		}
+		lost := requeueLostJobs(e.queue, key, cloud.takeLost())
+		for _, job := range lost {
+			e.stale[attemptKey(job)] = true
+		}
+		err := e.sim.recordLostJobs(e.run, lost, e.now)
+		if err != nil {
+			return err
+		}
+		if len(lost) > 0 {
+			err := e.dispatch(key)
+			if err != nil {
+				return err
+			}
+		}
+		e.scheduleInstanceEvents(key)
+	}
+	return nil
+}
+
+func attemptKey(job autoscale.AlgorithmJob) string {
+	return job.Id + "#" + strconv.Itoa(job.Attempts)
+}
+
+// scheduleInstanceEvents adds the times when booting instances become IDLE, draining instances are TERMINATED,
+// running instances crash and outages start and end
+func (e *engine) scheduleInstanceEvents(key string) {
+	cloud, ok := e.simCloud(key)
+	if !ok {
+		return
+	}
+	instances, _ := cloud.GetInstances()
+	for _, i := range instances {
+		var at time.Time
+		if i.State == autoscale.BOOTING {
+			at = i.ReadyAt
+		} else if i.State == autoscale.DRAINING && !i.TerminateAt.IsZero() {
+			at = i.TerminateAt
+		} else {
+			continue
+		}
+		if !at.After(e.now) {
+			continue
+		}
+		eventKey := i.Id + "@" + at.String()
+		if e.scheduled[eventKey] {
+			continue
+		}
+		e.scheduled[eventKey] = true
+		e.push(engineEvent{time: at, kind: instanceReady, cloud: key})
+	}
+	for _, at := range cloud.faultTimes() {
+		eventKey := key + "@" + at.String()
+		if !at.After(e.now) || e.scheduled[eventKey] {
+			continue
+		}
+		e.scheduled[eventKey] = true
+		e.push(engineEvent{time: at, kind: instanceReady, cloud: key})
+	}
+}
+
+func splitByTag(queue []autoscale.AlgorithmJob) map[string][]autoscale.AlgorithmJob {
+	queueMap := make(map[string][]autoscale.AlgorithmJob)
+	for _, j := range queue {
+		queueMap[j.Tag] = append(queueMap[j.Tag], j)
+	}
+	return queueMap
+}
+
+// unassignedInstance is a BUSY instance of the cloud that no running job in the queue is assigned to, it was BUSY
+// when the simulation started. The id is empty if there is none
+func unassignedInstance(cloud *SimCloud, queue []autoscale.AlgorithmJob) string {
+	assigned := make(map[string]bool)
+	for _, j := range queue {
+		if j.State == autoscale.RUNNING && j.InstanceId != "" {
+			assigned[j.InstanceId] = true
+		}
+	}
+	for _, i := range cloud.Cluster.ActiveInstances {
+		busy := i.State == autoscale.BUSY || (i.State == autoscale.DRAINING && i.TerminateAt.IsZero())
+		if busy && !assigned[i.Id] {
+			return i.Id
+		}
+	}
+	return ""
+}
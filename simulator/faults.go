@@ -0,0 +1,175 @@
+package simulator
+
+import (
+	"github.com/tteige/uit-go/autoscale"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// The fault model of a SimCloud. Every instance draws its boot outcome and its crash time from its own random
+// source, seeded from the cloud seed and the instance id, so the faults of an instance do not depend on the order
+// the instances are created or advanced in
+
+// bootFails decides if the booting instance fails instead of becoming IDLE
+func (c *SimCloud) bootFails(instance autoscale.Instance) bool {
+	faults := c.Cluster.Faults
+	if faults == nil || faults.BootFailure <= 0 {
+		return false
+	}
+	rng := rand.New(rand.NewSource(deriveSeed(c.seed, instance.Id+"@boot")))
+	return rng.Float64() < faults.BootFailure
+}
+
+// armCrash draws the crash time of a running instance that does not have one, the time between from and the
+// crash is exponentially distributed with the MTBF of the cluster as mean
+func (c *SimCloud) armCrash(instance autoscale.Instance, from time.Time) {
+	faults := c.Cluster.Faults
+	if faults == nil || faults.MTBF <= 0 {
+		return
+	}
+	if instance.State != autoscale.IDLE && instance.State != autoscale.BUSY && instance.State != autoscale.DRAINING {
+		return
+	}
+	if _, ok := c.crashAt[instance.Id]; ok {
+		return
+	}
+	rng := rand.New(rand.NewSource(deriveSeed(c.seed, instance.Id+"@crash")))
+	c.crashAt[instance.Id] = from.Add(time.Duration(rng.ExpFloat64() * faults.MTBF * float64(time.Second)))
+}
+
+// crash terminates the instance at once, the job running on it is lost. Interrupted spot and preemptible
+// instances are terminated the same way
+func (c *SimCloud) crash(instance autoscale.Instance, eventType string, at time.Time) error {
+	if instance.State == autoscale.BUSY || (instance.State == autoscale.DRAINING && instance.TerminateAt.IsZero()) {
+		c.lost = append(c.lost, instance.Id)
+	}
+	delete(c.crashAt, instance.Id)
+	delete(c.interruptAt, instance.Id)
+	instance.State = autoscale.TERMINATED
+	return c.writeEvent(instance, eventType, at)
+}
+
+// advanceOutages starts and ends the outages that are due at currentTime. Every instance crashes when an outage starts
+func (c *SimCloud) advanceOutages(currentTime time.Time) error {
+	if c.Cluster.Faults == nil {
+		return nil
+	}
+	outages := c.Cluster.Faults.Outages
+	for c.outagesStarted < len(outages) && !outages[c.outagesStarted].Start.After(currentTime) {
+		outage := outages[c.outagesStarted]
+		c.outagesStarted++
+		err := c.writeEvent(autoscale.Instance{}, "OUTAGE_START", outage.Start)
+		if err != nil {
+			return err
+		}
+		for _, e := range c.Cluster.ActiveInstances {
+			err = c.crash(e, "CRASHED", outage.Start)
+			if err != nil {
+				return err
+			}
+		}
+		c.Cluster.ActiveInstances = c.Cluster.ActiveInstances[:0]
+	}
+	//Outages can overlap and a later outage can end first, so every started outage ends on its own end time
+	var ended []int
+	for i, outage := range outages[:c.outagesStarted] {
+		if !c.outagesEnded[i] && !outage.End.After(currentTime) {
+			ended = append(ended, i)
+		}
+	}
+	sort.SliceStable(ended, func(i, j int) bool {
+		return outages[ended[i]].End.Before(outages[ended[j]].End)
+	})
+	for _, i := range ended {
+		err := c.writeEvent(autoscale.Instance{}, "OUTAGE_END", outages[i].End)
+		if err != nil {
+			return err
+		}
+		c.outagesEnded[i] = true
+	}
+	return nil
+}
+
+// down reports if the cloud is in an outage at currentTime
+func (c *SimCloud) down(currentTime time.Time) bool {
+	if c.Cluster.Faults == nil {
+		return false
+	}
+	for _, o := range c.Cluster.Faults.Outages {
+		if !currentTime.Before(o.Start) && currentTime.Before(o.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// faultTimes returns the coming crash and interruption times and outage starts and ends in time order
+func (c *SimCloud) faultTimes() []time.Time {
+	var times []time.Time
+	for _, at := range c.crashAt {
+		times = append(times, at)
+	}
+	for _, at := range c.interruptAt {
+		times = append(times, at)
+	}
+	if c.Cluster.Faults != nil {
+		outages := c.Cluster.Faults.Outages
+		for _, o := range outages[c.outagesStarted:] {
+			times = append(times, o.Start)
+		}
+		for i, o := range outages {
+			if !c.outagesEnded[i] {
+				times = append(times, o.End)
+			}
+		}
+	}
+	sort.Slice(times, func(i, j int) bool {
+		return times[i].Before(times[j])
+	})
+	return times
+}
+
+// takeLost returns the ids of the BUSY instances that crashed or were interrupted since it was last called
+func (c *SimCloud) takeLost() []string {
+	lost := c.lost
+	c.lost = nil
+	return lost
+}
+
+// requeueLostJobs puts the running jobs of the lost instances of the cloud back in the queue. The job of an
+// instance is the job assigned to it, or if no job is, the most recently started job without an instance.
+// Jobs assigned to another instance are never taken. The attempt counter of the jobs is increased, the returned
+// jobs are the lost attempts
+func requeueLostJobs(queue []autoscale.AlgorithmJob, tag string, lost []string) []autoscale.AlgorithmJob {
+	var lostJobs []autoscale.AlgorithmJob
+	for _, id := range lost {
+		index := -1
+		unassigned := -1
+		for i, j := range queue {
+			if j.Tag != tag || j.State != autoscale.RUNNING {
+				continue
+			}
+			if j.InstanceId == id {
+				index = i
+				break
+			}
+			if j.InstanceId == "" && (unassigned < 0 || !j.Started.Before(queue[unassigned].Started)) {
+				unassigned = i
+			}
+		}
+		if index < 0 {
+			index = unassigned
+		}
+		if index < 0 {
+			//The instance had no job
+			continue
+		}
+		lostJobs = append(lostJobs, queue[index])
+		queue[index].State = autoscale.QUEUED
+		queue[index].Started = time.Time{}
+		queue[index].InstanceId = ""
+		queue[index].Attempts++
+	}
+	return lostJobs
+}
@@ -0,0 +1,50 @@
+package simulator
+
+import (
+	"github.com/tteige/uit-go/autoscale"
+	"github.com/tteige/uit-go/models"
+	"testing"
+	"time"
+)
+
+func TestOverlappingOutages(t *testing.T) {
+	start := time.Date(2017, 11, 24, 0, 0, 0, 0, time.UTC)
+	at := func(hours int) time.Time {
+		return start.Add(time.Duration(hours) * time.Hour)
+	}
+	store := models.NewMemoryStore()
+	cloud := newSimCloud(autoscale.Cluster{Name: "aws", Faults: &autoscale.FaultModel{Outages: []autoscale.Outage{
+		{Start: at(1), End: at(6)},
+		{Start: at(2), End: at(3)},
+	}}}, store, 1)
+	for _, now := range cloud.faultTimes() {
+		if err := cloud.advanceOutages(now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events, err := store.GetAutoscalingRunEvents("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	//The outage inside the first one ends on its own end time
+	want := []struct {
+		eventType string
+		at        time.Time
+	}{
+		{"OUTAGE_START", at(1)},
+		{"OUTAGE_START", at(2)},
+		{"OUTAGE_END", at(3)},
+		{"OUTAGE_END", at(6)},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d", len(events), len(want))
+	}
+	for i, w := range want {
+		if events[i].Type != w.eventType || !events[i].Created.Equal(w.at) {
+			t.Errorf("event %d is %s at %v, want %s at %v", i, events[i].Type, events[i].Created, w.eventType, w.at)
+		}
+	}
+	if len(cloud.faultTimes()) != 0 {
+		t.Errorf("fault times %v are left after every outage ended", cloud.faultTimes())
+	}
+}
@@ -0,0 +1,42 @@
+package simulator
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// assignmentsHandle writes which job attempt ran on which instance of a run, and when
+func (sim *Simulator) assignmentsHandle(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	sim.Log.Printf("AssignmentsRequest: /metapipe/simulation/%s/assignments", id)
+
+	if _, err := sim.Store.GetAutoscalingRun(id); err != nil {
+		http.Error(w, "unknown simulation "+id, http.StatusNotFound)
+		return
+	}
+	assignments, err := sim.Store.GetJobAssignments(id)
+	if err != nil && err != sql.ErrNoRows {
+		sim.Log.Print(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	enc := json.NewEncoder(w)
+	enc.Encode(&assignments)
+}
+
+// ganttPageHandle renders the assignments of a run with a lane for every instance, grouped by cloud
+func (sim *Simulator) ganttPageHandle(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	sim.Log.Printf("GanttPageRequest: /gantt/%s", id)
+
+	if _, err := sim.Store.GetAutoscalingRun(id); err != nil {
+		http.Error(w, "unknown simulation "+id, http.StatusNotFound)
+		return
+	}
+	err := sim.renderTemplate(w, "gantt", struct{ Id string }{id})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
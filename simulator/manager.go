@@ -0,0 +1,287 @@
+package simulator
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// retention is how long the manager keeps a run or a batch after it is done. Later requests for a run or a sweep
+// are served from the store, the others are unknown
+var retention = time.Hour
+
+// The states of a simulation run
+const (
+	RunQueued    = "queued"
+	RunRunning   = "running"
+	RunFinished  = "finished"
+	RunFailed    = "failed"
+	RunCancelled = "cancelled"
+)
+
+// RunStatus is the progress of a simulation run, Iteration is the last algorithm iteration that completed
+type RunStatus struct {
+	Id         string `json:"id"`
+	State      string `json:"state"`
+	Iteration  int    `json:"iteration"`
+	Iterations int    `json:"iterations"`
+	Error      string `json:"error,omitempty"`
+}
+
+func (s RunStatus) done() bool {
+	return s.State == RunFinished || s.State == RunFailed || s.State == RunCancelled
+}
+
+type runResult struct {
+	out simulationOutput
+	err error
+}
+
+type managedRun struct {
+	status RunStatus
+	cancel context.CancelFunc
+	hub    *eventHub
+}
+
+// runManager runs every simulation in its own goroutine. Each run has its own clouds, created from a copy of
+// the cluster state, so runs never share instances. At most limit simulations run at the same time,
+// the others are queued until a slot is free. Done entries are forgotten after the retention time
+type runManager struct {
+	sim   *Simulator
+	slots chan struct{}
+	mu    sync.Mutex
+	runs  map[string]*managedRun
+	mcs   map[string]*monteCarlo
+	cmps  map[string]*comparison
+	swps  map[string]*sweep
+	plans map[string]*planner
+}
+
+func newRunManager(sim *Simulator, limit int) *runManager {
+	if limit <= 0 {
+		limit = runtime.NumCPU()
+	}
+	return &runManager{
+		sim:   sim,
+		slots: make(chan struct{}, limit),
+		runs:  make(map[string]*managedRun),
+		mcs:   make(map[string]*monteCarlo),
+		cmps:  make(map[string]*comparison),
+		swps:  make(map[string]*sweep),
+		plans: make(map[string]*planner),
+	}
+}
+
+// start queues the simulation and runs it in the background, the result is sent on the returned channel when it
+// is done. The run can be followed with status and stopped with cancel
+func (m *runManager) start(run metapipeReturn) <-chan runResult {
+	ctx, cancel := context.WithCancel(context.Background())
+	run.ctx = ctx
+	run.progress = func(iteration int) {
+		m.update(run.id, func(s *RunStatus) {
+			s.Iteration = iteration
+		})
+	}
+
+	m.mu.Lock()
+	m.runs[run.id] = &managedRun{
+		status: RunStatus{
+			Id:         run.id,
+			State:      RunQueued,
+			Iterations: run.iterations,
+		},
+		cancel: cancel,
+		hub:    run.hub,
+	}
+	m.mu.Unlock()
+
+	result := make(chan runResult, 1)
+	go func() {
+		defer cancel()
+		select {
+		case m.slots <- struct{}{}:
+		case <-ctx.Done():
+			m.finish(run.id, ctx.Err())
+			result <- runResult{err: ctx.Err()}
+			return
+		}
+		defer func() { <-m.slots }()
+
+		m.update(run.id, func(s *RunStatus) {
+			s.State = RunRunning
+		})
+		out, err := m.sim.simulate(run)
+		m.finish(run.id, err)
+		result <- runResult{out: out, err: err}
+	}()
+	return result
+}
+
+// expire calls remove with the manager locked when the retention time has passed
+func (m *runManager) expire(remove func()) {
+	time.AfterFunc(retention, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		remove()
+	})
+}
+
+// forget expires an entry when done is closed. The entry is only removed if it has not been replaced by a newer
+// one with the same name
+func (m *runManager) forget(done <-chan struct{}, remove func()) {
+	go func() {
+		<-done
+		m.expire(remove)
+	}()
+}
+
+// status returns the status of a run started by the manager
+func (m *runManager) status(id string) (RunStatus, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.runs[id]
+	if !ok {
+		return RunStatus{}, false
+	}
+	return r.status, true
+}
+
+// cancel stops a queued or running simulation, it returns false if the run is unknown or already done
+func (m *runManager) cancel(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.runs[id]
+	if !ok || r.status.done() {
+		return false
+	}
+	r.cancel()
+	return true
+}
+
+// events returns the event hub of a queued or running simulation, nil if the run is done or unknown
+func (m *runManager) events(id string) *eventHub {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if r, ok := m.runs[id]; ok {
+		return r.hub
+	}
+	return nil
+}
+
+// finish sets the final state of the run and ends its event streams
+func (m *runManager) finish(id string, err error) {
+	defer m.closeEvents(id)
+	m.mu.Lock()
+	if r, ok := m.runs[id]; ok {
+		m.expire(func() {
+			if m.runs[id] == r {
+				delete(m.runs, id)
+			}
+		})
+	}
+	m.mu.Unlock()
+	m.update(id, func(s *RunStatus) {
+		switch {
+		case err == context.Canceled:
+			s.State = RunCancelled
+		case err != nil:
+			s.State = RunFailed
+			s.Error = err.Error()
+		default:
+			s.State = RunFinished
+			s.Iteration = s.Iterations
+		}
+	})
+}
+
+// closeEvents ends the event streams of the run. The manager lets go of the events, later subscribers read them
+// from the store
+func (m *runManager) closeEvents(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if r, ok := m.runs[id]; ok && r.hub != nil {
+		r.hub.close()
+		r.hub = nil
+	}
+}
+
+func (m *runManager) update(id string, f func(s *RunStatus)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if r, ok := m.runs[id]; ok {
+		f(&r.status)
+	}
+}
+
+func (m *runManager) addMonteCarlo(mc *monteCarlo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mcs[mc.name] = mc
+	m.forget(mc.done, func() {
+		if m.mcs[mc.name] == mc {
+			delete(m.mcs, mc.name)
+		}
+	})
+}
+
+func (m *runManager) monteCarlo(name string) (*monteCarlo, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mc, ok := m.mcs[name]
+	return mc, ok
+}
+
+func (m *runManager) addComparison(c *comparison) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cmps[c.name] = c
+	m.forget(c.done, func() {
+		if m.cmps[c.name] == c {
+			delete(m.cmps, c.name)
+		}
+	})
+}
+
+func (m *runManager) comparison(name string) (*comparison, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.cmps[name]
+	return c, ok
+}
+
+func (m *runManager) addSweep(s *sweep) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.swps[s.name] = s
+	m.forget(s.done, func() {
+		if m.swps[s.name] == s {
+			delete(m.swps, s.name)
+		}
+	})
+}
+
+func (m *runManager) sweep(name string) (*sweep, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.swps[name]
+	return s, ok
+}
+
+func (m *runManager) addPlan(p *planner) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.plans[p.name] = p
+	m.forget(p.done, func() {
+		if m.plans[p.name] == p {
+			delete(m.plans, p.name)
+		}
+	})
+}
+
+func (m *runManager) plan(name string) (*planner, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.plans[name]
+	return p, ok
+}
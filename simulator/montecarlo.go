@@ -0,0 +1,234 @@
+package simulator
+
+import (
+	"fmt"
+	"github.com/tteige/uit-go/metapipe"
+	"math"
+	"net/http"
+)
+
+// Estimate is the mean of a value over the runs of a Monte Carlo simulation with its 95% confidence interval
+type Estimate struct {
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"std_dev"`
+	Low    float64 `json:"ci_low"`
+	High   float64 `json:"ci_high"`
+}
+
+// CloudEstimate is the outcome of a cloud over the runs of a Monte Carlo simulation. Cost is the billed cost of the
+// instances of the cloud, makespan is the time from the start of the simulation until the last job finished and
+// queue duration is the mean queue duration of the simulator events, both in milliseconds
+type CloudEstimate struct {
+	Cost          Estimate `json:"cost"`
+	Makespan      Estimate `json:"makespan"`
+	QueueDuration Estimate `json:"queue_duration"`
+}
+
+type MonteCarloReport struct {
+	Name   string                   `json:"name"`
+	Runs   []string                 `json:"runs"`
+	Seeds  []int64                  `json:"seeds"`
+	Clouds map[string]CloudEstimate `json:"clouds"`
+}
+
+// MonteCarloStatus is the state of every run of a Monte Carlo simulation, the report is set when all are finished
+type MonteCarloStatus struct {
+	Name   string            `json:"name"`
+	State  string            `json:"state"`
+	Runs   []RunStatus       `json:"runs"`
+	Report *MonteCarloReport `json:"report,omitempty"`
+	Error  string            `json:"error,omitempty"`
+}
+
+type monteCarlo struct {
+	batch
+	runs   []metapipeReturn
+	seeds  []int64
+	report *MonteCarloReport
+}
+
+// MonteCarlo runs the simulation request MonteCarloRuns times with different seeds and waits for the report
+func (sim *Simulator) MonteCarlo(input metapipe.ScalingRequestInput) (MonteCarloReport, error) {
+	mc, err := sim.startMonteCarlo(input)
+	if err != nil {
+		return MonteCarloReport{}, err
+	}
+	err = mc.wait()
+	if err != nil {
+		return MonteCarloReport{}, err
+	}
+	return *mc.report, nil
+}
+
+// startMonteCarlo starts every run of a Monte Carlo simulation. The runs are named after the simulation with
+// the run number appended and use the seeds Seed, Seed+1, ...
+func (sim *Simulator) startMonteCarlo(input metapipe.ScalingRequestInput) (*monteCarlo, error) {
+	if input.MonteCarloRuns < 1 {
+		return nil, invalidRequest(fmt.Errorf("a Monte Carlo simulation needs at least one run"))
+	}
+	runs := input.MonteCarloRuns
+	input = sim.batchInput(input)
+	mc := &monteCarlo{batch: newBatch(input.Name)}
+
+	//The jobs are estimated once, every run starts from the same queue
+	jobs, err := sim.loadJobs(input)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < runs; i++ {
+		runInput := input
+		runInput.Name = fmt.Sprintf("%s-%d", mc.name, i+1)
+		runInput.Seed = input.Seed + int64(i)
+		run := sim.prepareRunWithJobs(runInput, jobs)
+		if run.err != nil {
+			return nil, run.err
+		}
+		mc.runs = append(mc.runs, run)
+		mc.seeds = append(mc.seeds, runInput.Seed)
+	}
+
+	wait := sim.startRuns(mc.runs)
+	sim.runs().addMonteCarlo(mc)
+	go func() {
+		defer close(mc.done)
+		mc.err = wait()
+		if mc.err != nil {
+			return
+		}
+		report, err := sim.monteCarloReport(mc)
+		mc.report = &report
+		mc.err = err
+	}()
+	return mc, nil
+}
+
+// monteCarloHandle starts a Monte Carlo simulation, its runs and report are polled at the returned location
+func (sim *Simulator) monteCarloHandle(w http.ResponseWriter, reqInput metapipe.ScalingRequestInput) {
+	mc, err := sim.startMonteCarlo(reqInput)
+	if err != nil {
+		sim.Log.Print(err)
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	status := sim.monteCarloStatus(mc)
+	sim.acceptBatch(w, "Monte Carlo simulation", "/metapipe/montecarlo/", &mc.batch, &status)
+}
+
+// monteCarloStatusHandle reports the runs of a Monte Carlo simulation, and the report when they are all finished
+func (sim *Simulator) monteCarloStatusHandle() http.HandlerFunc {
+	return sim.batchStatusHandle("Monte Carlo simulation", func(name string) (interface{}, bool) {
+		mc, ok := sim.runs().monteCarlo(name)
+		if !ok {
+			return nil, false
+		}
+		status := sim.monteCarloStatus(mc)
+		return &status, true
+	})
+}
+
+func (sim *Simulator) monteCarloStatus(mc *monteCarlo) MonteCarloStatus {
+	status := MonteCarloStatus{
+		Name:  mc.name,
+		State: RunRunning,
+	}
+	for _, run := range mc.runs {
+		s, _ := sim.runStatus(run.id)
+		status.Runs = append(status.Runs, s)
+	}
+	select {
+	case <-mc.done:
+		status.State = RunFinished
+		status.Report = mc.report
+		if mc.err != nil {
+			status.State = RunFailed
+			status.Error = mc.err.Error()
+		}
+	default:
+	}
+	return status
+}
+
+func (sim *Simulator) monteCarloReport(mc *monteCarlo) (MonteCarloReport, error) {
+	report := MonteCarloReport{
+		Name:   mc.name,
+		Seeds:  mc.seeds,
+		Clouds: make(map[string]CloudEstimate),
+	}
+	costs := make(map[string][]float64)
+	makespans := make(map[string][]float64)
+	queueDurations := make(map[string][]float64)
+	for _, run := range mc.runs {
+		report.Runs = append(report.Runs, run.id)
+		in, err := sim.runInput(run.id)
+		if err != nil {
+			return report, err
+		}
+		out, err := sim.loadOutput(run.id)
+		if err != nil {
+			return report, err
+		}
+		metrics, _ := computeMetrics(in, out)
+		for key := range run.input.Clouds {
+			var queueDuration float64
+			events := 0
+			for _, e := range out.SimEvents {
+				if e.Tag == key {
+					queueDuration += float64(e.QueueDuration)
+					events++
+				}
+			}
+			if events > 0 {
+				queueDuration /= float64(events)
+			}
+			costs[key] = append(costs[key], metrics[key].BilledCost)
+			makespans[key] = append(makespans[key], float64(metrics[key].Makespan))
+			queueDurations[key] = append(queueDurations[key], queueDuration)
+		}
+	}
+	for key := range costs {
+		report.Clouds[key] = CloudEstimate{
+			Cost:          estimate(costs[key]),
+			Makespan:      estimate(makespans[key]),
+			QueueDuration: estimate(queueDurations[key]),
+		}
+	}
+	return report, nil
+}
+
+func estimate(values []float64) Estimate {
+	n := float64(len(values))
+	if n == 0 {
+		return Estimate{}
+	}
+	var e Estimate
+	for _, v := range values {
+		e.Mean += v
+	}
+	e.Mean /= n
+	if n > 1 {
+		for _, v := range values {
+			e.StdDev += (v - e.Mean) * (v - e.Mean)
+		}
+		e.StdDev = math.Sqrt(e.StdDev / (n - 1))
+	}
+	half := tQuantile(len(values)-1) * e.StdDev / math.Sqrt(n)
+	e.Low = e.Mean - half
+	e.High = e.Mean + half
+	return e
+}
+
+// tQuantiles are the 97.5% quantiles of Student's t-distribution for 1 to 30 degrees of freedom
+var tQuantiles = []float64{12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042}
+
+// tQuantile gives the width of a two sided 95% confidence interval in standard errors
+func tQuantile(df int) float64 {
+	if df < 1 {
+		return 0
+	}
+	if df > len(tQuantiles) {
+		return 1.96
+	}
+	return tQuantiles[df-1]
+}
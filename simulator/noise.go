@@ -0,0 +1,113 @@
+package simulator
+
+import (
+	"fmt"
+	"github.com/tteige/uit-go/autoscale"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// runtimeNoise draws the actual execution times of the jobs of a run from the noise model of their cloud.
+// Every job gets its own random source seeded from the run seed and the job, so the actual execution time of a
+// job does not depend on the order the jobs are started in
+type runtimeNoise struct {
+	seed      int64
+	specs     map[string]autoscale.NoiseSpec
+	residuals map[string][]float64
+	mu        sync.Mutex
+	actual    map[string]int64
+}
+
+func newRuntimeNoise(specs map[string]autoscale.NoiseSpec, seed int64, est autoscale.Estimator) (*runtimeNoise, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	n := &runtimeNoise{
+		seed:      seed,
+		specs:     specs,
+		residuals: make(map[string][]float64),
+		actual:    make(map[string]int64),
+	}
+	for cloud, spec := range specs {
+		switch spec.Model {
+		case autoscale.NormalNoise, autoscale.LognormalNoise:
+			if spec.Sigma < 0 {
+				return nil, fmt.Errorf("negative sigma in the noise of %s", cloud)
+			}
+		case autoscale.EmpiricalNoise:
+			residuals := spec.Residuals
+			if len(residuals) == 0 {
+				if source, ok := est.(autoscale.ResidualSource); ok {
+					residuals = source.Residuals(cloud)
+				}
+			}
+			if len(residuals) == 0 {
+				return nil, fmt.Errorf("no residuals for the empirical noise of %s", cloud)
+			}
+			n.residuals[cloud] = residuals
+		default:
+			return nil, fmt.Errorf("unknown noise model %q for %s", spec.Model, cloud)
+		}
+	}
+	return n, nil
+}
+
+// resolvedSpecs returns the noise specs with the residuals of the empirical models filled in,
+// so the noise can be recreated without the estimator
+func (n *runtimeNoise) resolvedSpecs() map[string]autoscale.NoiseSpec {
+	if n == nil {
+		return nil
+	}
+	specs := make(map[string]autoscale.NoiseSpec, len(n.specs))
+	for cloud, spec := range n.specs {
+		if residuals, ok := n.residuals[cloud]; ok {
+			spec.Residuals = residuals
+		}
+		specs[cloud] = spec
+	}
+	return specs
+}
+
+// executionTime returns the actual execution time in milliseconds of the job on the cloud of its tag
+func (n *runtimeNoise) executionTime(job autoscale.AlgorithmJob) int64 {
+	estimate := job.ExecutionTime[job.Tag]
+	if n == nil {
+		return estimate
+	}
+	spec, ok := n.specs[job.Tag]
+	if !ok {
+		return estimate
+	}
+	key := job.Id + "@" + job.Tag
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if actual, ok := n.actual[key]; ok {
+		return actual
+	}
+	rng := rand.New(rand.NewSource(deriveSeed(n.seed, key)))
+
+	var factor float64
+	switch spec.Model {
+	case autoscale.NormalNoise:
+		factor = 1 + rng.NormFloat64()*spec.Sigma
+	case autoscale.LognormalNoise:
+		//The mean of the log is shifted so the factor has mean 1
+		factor = math.Exp(rng.NormFloat64()*spec.Sigma - spec.Sigma*spec.Sigma/2)
+	case autoscale.EmpiricalNoise:
+		residuals := n.residuals[job.Tag]
+		factor = residuals[rng.Intn(len(residuals))]
+	}
+	actual := int64(float64(estimate) * math.Max(factor, 0))
+	n.actual[key] = actual
+	return actual
+}
+
+// deriveSeed gives every key its own seed derived from the run seed
+func deriveSeed(seed int64, key string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return seed ^ int64(h.Sum64())
+}
@@ -0,0 +1,167 @@
+package simulator
+
+import (
+	"github.com/tteige/uit-go/autoscale"
+	"sort"
+	"time"
+)
+
+// JobOutcome is what happened to a job in a run. The wait, turnaround and slowdown are counted from the job
+// arrived, or from the start of the run for jobs that were queued before it. The wait of a job that never
+// started lasts until the run ended, the turnaround and slowdown are zero for jobs that did not finish.
+// The times are in milliseconds
+type JobOutcome struct {
+	JobId       string    `json:"job_id"`
+	Cloud       string    `json:"cloud"`
+	InstanceId  string    `json:"instance_id"`
+	Priority    int       `json:"priority"`
+	State       string    `json:"state"`
+	Attempts    int       `json:"attempts"`
+	Submitted   time.Time `json:"submitted"`
+	Started     time.Time `json:"started"`
+	Finished    time.Time `json:"finished"`
+	Deadline    time.Time `json:"deadline"`
+	Wait        int64     `json:"wait"`
+	Turnaround  int64     `json:"turnaround"`
+	Slowdown    float64   `json:"slowdown"`
+	DeadlineMet bool      `json:"deadline_met"`
+}
+
+// Distribution is the mean and the nearest rank percentiles of a set of values
+type Distribution struct {
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P95  float64 `json:"p95"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+// OutcomeStats is the distribution of the job outcomes of a cloud or a run. The wait covers every job,
+// the turnaround and slowdown only the finished jobs
+type OutcomeStats struct {
+	Jobs           int          `json:"jobs"`
+	Finished       int          `json:"finished"`
+	DeadlineMisses int          `json:"deadline_misses"`
+	Wait           Distribution `json:"wait"`
+	Turnaround     Distribution `json:"turnaround"`
+	Slowdown       Distribution `json:"slowdown"`
+}
+
+// RunOutcomes is the outcome of every job of a run, with their distribution for each cloud and in total
+type RunOutcomes struct {
+	Jobs   []JobOutcome            `json:"jobs"`
+	Total  OutcomeStats            `json:"total"`
+	Clouds map[string]OutcomeStats `json:"clouds"`
+}
+
+// jobOutcomes computes the outcome of the stored jobs of a run, sorted by submit time
+func jobOutcomes(in RunInput, jobs []autoscale.AlgorithmJob) []JobOutcome {
+	start := in.StartTime
+	end := in.end()
+	outcomes := make([]JobOutcome, 0, len(jobs))
+	for _, job := range jobs {
+		o := JobOutcome{
+			JobId:       job.Id,
+			Cloud:       job.Tag,
+			InstanceId:  job.InstanceId,
+			Priority:    job.Priority,
+			State:       job.State,
+			Attempts:    job.Attempts,
+			Submitted:   job.Created,
+			Started:     job.Started,
+			Deadline:    job.Deadline,
+			DeadlineMet: true,
+		}
+		arrival := job.Created
+		if arrival.Before(start) {
+			arrival = start
+		}
+		//A job already running at the start of the run is counted from the start, it did not wait in the run
+		started := job.Started
+		if !started.IsZero() && started.Before(arrival) {
+			started = arrival
+		}
+		if started.IsZero() {
+			o.Wait = int64(end.Sub(arrival) / time.Millisecond)
+		} else {
+			o.Wait = int64(started.Sub(arrival) / time.Millisecond)
+		}
+		if job.State == autoscale.FINISHED {
+			runtime := time.Millisecond * time.Duration(job.ExecutionTime[job.Tag])
+			o.Finished = job.Started.Add(runtime)
+			finished := o.Finished
+			if finished.Before(started) {
+				finished = started
+			}
+			o.Turnaround = int64(finished.Sub(arrival) / time.Millisecond)
+			if ran := finished.Sub(started); ran > 0 {
+				o.Slowdown = float64(finished.Sub(arrival)) / float64(ran)
+			}
+			o.DeadlineMet = job.Deadline.IsZero() || !o.Finished.After(job.Deadline)
+		} else {
+			//An unfinished job has only missed its deadline if it passed before the run ended
+			o.DeadlineMet = job.Deadline.IsZero() || !job.Deadline.Before(end)
+		}
+		outcomes = append(outcomes, o)
+	}
+	sort.SliceStable(outcomes, func(i, j int) bool {
+		return outcomes[i].Submitted.Before(outcomes[j].Submitted)
+	})
+	return outcomes
+}
+
+// runOutcomes computes the job outcomes of a run and their distribution for each cloud of the run
+func runOutcomes(in RunInput, jobs []autoscale.AlgorithmJob) RunOutcomes {
+	outcomes := jobOutcomes(in, jobs)
+	run := RunOutcomes{
+		Jobs:   outcomes,
+		Total:  outcomeStats(outcomes),
+		Clouds: make(map[string]OutcomeStats),
+	}
+	byCloud := make(map[string][]JobOutcome)
+	for key := range in.Clusters {
+		byCloud[key] = nil
+	}
+	for _, o := range outcomes {
+		//Untagged jobs that never started belong to no cloud, they are only counted in the total
+		if _, ok := in.Clusters[o.Cloud]; ok {
+			byCloud[o.Cloud] = append(byCloud[o.Cloud], o)
+		}
+	}
+	for key, o := range byCloud {
+		run.Clouds[key] = outcomeStats(o)
+	}
+	return run
+}
+
+func outcomeStats(outcomes []JobOutcome) OutcomeStats {
+	stats := OutcomeStats{Jobs: len(outcomes)}
+	var waits, turnarounds, slowdowns []float64
+	for _, o := range outcomes {
+		waits = append(waits, float64(o.Wait))
+		if o.State == autoscale.FINISHED {
+			stats.Finished++
+			turnarounds = append(turnarounds, float64(o.Turnaround))
+			slowdowns = append(slowdowns, o.Slowdown)
+		}
+		if !o.DeadlineMet {
+			stats.DeadlineMisses++
+		}
+	}
+	stats.Wait = distribution(waits)
+	stats.Turnaround = distribution(turnarounds)
+	stats.Slowdown = distribution(slowdowns)
+	return stats
+}
+
+func distribution(values []float64) Distribution {
+	return Distribution{
+		Mean: mean(values),
+		P50:  percentile(values, 50),
+		P90:  percentile(values, 90),
+		P95:  percentile(values, 95),
+		P99:  percentile(values, 99),
+		Max:  percentile(values, 100),
+	}
+}
@@ -0,0 +1,350 @@
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/tteige/uit-go/algorithm"
+	"github.com/tteige/uit-go/autoscale"
+	"github.com/tteige/uit-go/metapipe"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SLO is the service level a capacity plan has to meet in every run. The waits are in seconds, a zero wait
+// has no limit
+type SLO struct {
+	P95Wait           float64 `json:"p95_wait"`
+	MeanWait          float64 `json:"mean_wait"`
+	MaxDeadlineMisses int     `json:"max_deadline_misses"`
+	MaxUnfinished     int     `json:"max_unfinished"`
+}
+
+// LimitRange is the range of instance limits the planner searches for a cloud
+type LimitRange struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+// PlanSpec searches the limits of the clouds for the cheapest configuration where the base request meets the SLO.
+// Every configuration is simulated Runs times with the seeds Seed, Seed+1, ... The clouds without a range keep
+// the limit of the base request
+type PlanSpec struct {
+	Name   string                       `json:"name"`
+	Base   metapipe.ScalingRequestInput `json:"base"`
+	SLO    SLO                          `json:"slo"`
+	Limits map[string]LimitRange        `json:"limits"`
+	Runs   int                          `json:"runs"`
+}
+
+// PlanStep is a configuration the planner simulated. The cost is the mean billed cost of its runs, the waits,
+// deadline misses and unfinished jobs are the worst of its runs
+type PlanStep struct {
+	Limits         map[string]int `json:"limits"`
+	Runs           []string       `json:"runs"`
+	Cost           float64        `json:"cost"`
+	P95Wait        float64        `json:"p95_wait"`
+	MeanWait       float64        `json:"mean_wait"`
+	DeadlineMisses int            `json:"deadline_misses"`
+	Unfinished     int            `json:"unfinished"`
+	MeetsSLO       bool           `json:"meets_slo"`
+}
+
+// Plan is the state of a capacity planner. Limits is the cheapest configuration found that meets the SLO,
+// it is nil if none of the simulated configurations does
+type Plan struct {
+	Name   string         `json:"name"`
+	State  string         `json:"state"`
+	SLO    SLO            `json:"slo"`
+	Limits map[string]int `json:"limits"`
+	Cost   float64        `json:"cost"`
+	Steps  []PlanStep     `json:"steps"`
+	Error  string         `json:"error,omitempty"`
+}
+
+type planner struct {
+	batch
+	sim   *Simulator
+	spec  PlanSpec
+	jobs  []autoscale.AlgorithmJob
+	mu    sync.Mutex
+	plan  Plan
+	steps map[string]PlanStep
+}
+
+// Plan searches for the cheapest limits that meet the SLO and waits for the result
+func (sim *Simulator) Plan(spec PlanSpec) (Plan, error) {
+	p, err := sim.startPlan(spec)
+	if err != nil {
+		return Plan{}, err
+	}
+	err = p.wait()
+	return p.status(), err
+}
+
+func (sim *Simulator) startPlan(spec PlanSpec) (*planner, error) {
+	if spec.Base.Clusters == nil {
+		spec.Base.Clusters = sim.SimClusters
+	}
+	if len(spec.Limits) == 0 {
+		return nil, invalidRequest(fmt.Errorf("the plan has no limits to search"))
+	}
+	for cloud, r := range spec.Limits {
+		if _, ok := spec.Base.Clusters[cloud]; !ok {
+			return nil, invalidRequest(fmt.Errorf("limits for unknown cloud %s", cloud))
+		}
+		if r.Min < 0 || r.Max < r.Min {
+			return nil, invalidRequest(fmt.Errorf("invalid limit range %d to %d for %s", r.Min, r.Max, cloud))
+		}
+	}
+	//The runs are started while the planner searches, so the algorithm is checked before the plan is accepted
+	if spec.Base.Algorithm != nil {
+		_, err := algorithm.FromSpec(*spec.Base.Algorithm)
+		if err != nil {
+			return nil, invalidRequest(err)
+		}
+	}
+	if spec.Runs < 1 {
+		spec.Runs = 1
+	}
+	spec.Base = sim.batchInput(spec.Base)
+
+	jobs, err := sim.loadJobs(spec.Base)
+	if err != nil {
+		return nil, err
+	}
+	p := &planner{
+		batch: newBatch(spec.Name),
+		sim:   sim,
+		jobs:  jobs,
+		steps: make(map[string]PlanStep),
+	}
+	spec.Name = p.name
+	p.spec = spec
+	p.plan = Plan{Name: spec.Name, State: RunRunning, SLO: spec.SLO}
+	sim.runs().addPlan(p)
+	go func() {
+		defer close(p.done)
+		p.err = p.search()
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.plan.State = RunFinished
+		if p.err != nil {
+			p.plan.State = RunFailed
+			p.plan.Error = p.err.Error()
+		}
+	}()
+	return p, nil
+}
+
+// search starts from the highest limits and lowers one cloud at a time. For every cloud it binary searches the
+// lowest limit that still meets the SLO with the other limits fixed, and moves to the cheapest of these
+// configurations. It stops when no cloud can be lowered without a higher cost. More instances are assumed
+// to never give longer waits
+func (p *planner) search() error {
+	clouds := make([]string, 0, len(p.spec.Limits))
+	for cloud := range p.spec.Limits {
+		clouds = append(clouds, cloud)
+	}
+	sort.Strings(clouds)
+
+	current := make(map[string]int)
+	for _, cloud := range clouds {
+		current[cloud] = p.spec.Limits[cloud].Max
+	}
+	step, err := p.evaluate(current)
+	if err != nil || !step.MeetsSLO {
+		return err
+	}
+	for {
+		var best map[string]int
+		bestStep := step
+		for _, cloud := range clouds {
+			lo, hi := p.spec.Limits[cloud].Min, current[cloud]
+			for lo < hi {
+				mid := (lo + hi) / 2
+				candidate := withLimit(current, cloud, mid)
+				s, err := p.evaluate(candidate)
+				if err != nil {
+					return err
+				}
+				if s.MeetsSLO {
+					hi = mid
+				} else {
+					lo = mid + 1
+				}
+			}
+			if hi == current[cloud] {
+				continue
+			}
+			s, err := p.evaluate(withLimit(current, cloud, hi))
+			if err != nil {
+				return err
+			}
+			//A lower limit at the same cost is still a smaller quota, the limits only go down so the search ends
+			if s.Cost <= bestStep.Cost {
+				best = withLimit(current, cloud, hi)
+				bestStep = s
+			}
+		}
+		if best == nil {
+			return nil
+		}
+		current = best
+		step = bestStep
+	}
+}
+
+func withLimit(limits map[string]int, cloud string, limit int) map[string]int {
+	out := make(map[string]int, len(limits))
+	for k, v := range limits {
+		out[k] = v
+	}
+	out[cloud] = limit
+	return out
+}
+
+// evaluate simulates the configuration Runs times, a configuration that was simulated before is not run again
+func (p *planner) evaluate(limits map[string]int) (PlanStep, error) {
+	key := limitsKey(limits)
+	p.mu.Lock()
+	step, ok := p.steps[key]
+	number := len(p.steps) + 1
+	p.mu.Unlock()
+	if ok {
+		return step, nil
+	}
+
+	step = PlanStep{Limits: limits}
+	var runs []metapipeReturn
+	for i := 0; i < p.spec.Runs; i++ {
+		runInput := p.spec.Base
+		runInput.Name = fmt.Sprintf("%s-%d-%d", p.spec.Name, number, i+1)
+		runInput.Seed = p.spec.Base.Seed + int64(i)
+		runInput.Clusters = p.spec.Base.Clusters.Copy()
+		for cloud, limit := range limits {
+			cluster := runInput.Clusters[cloud]
+			cluster.Limit = limit
+			runInput.Clusters[cloud] = cluster
+		}
+		run := p.sim.prepareRunWithJobs(runInput, p.jobs)
+		if run.err != nil {
+			return step, run.err
+		}
+		runs = append(runs, run)
+	}
+	err := p.sim.startRuns(runs)()
+	if err != nil {
+		return step, err
+	}
+
+	for _, run := range runs {
+		_, total, err := p.sim.runMetrics(run.id)
+		if err != nil {
+			return step, err
+		}
+		step.Runs = append(step.Runs, run.id)
+		step.Cost += total.BilledCost / float64(len(runs))
+		if total.P95Wait > step.P95Wait {
+			step.P95Wait = total.P95Wait
+		}
+		if total.MeanWait > step.MeanWait {
+			step.MeanWait = total.MeanWait
+		}
+		if total.DeadlineMisses > step.DeadlineMisses {
+			step.DeadlineMisses = total.DeadlineMisses
+		}
+		if total.Unfinished > step.Unfinished {
+			step.Unfinished = total.Unfinished
+		}
+	}
+	step.MeetsSLO = p.spec.SLO.met(step)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.steps[key] = step
+	p.plan.Steps = append(p.plan.Steps, step)
+	//On equal cost the smaller quota is the better plan
+	if step.MeetsSLO && (p.plan.Limits == nil || step.Cost < p.plan.Cost ||
+		step.Cost == p.plan.Cost && totalLimit(limits) < totalLimit(p.plan.Limits)) {
+		p.plan.Limits = limits
+		p.plan.Cost = step.Cost
+	}
+	return step, nil
+}
+
+func totalLimit(limits map[string]int) int {
+	total := 0
+	for _, limit := range limits {
+		total += limit
+	}
+	return total
+}
+
+// met checks the step against the SLO, the waits of the step are in milliseconds
+func (s SLO) met(step PlanStep) bool {
+	ms := float64(time.Second / time.Millisecond)
+	if s.P95Wait > 0 && step.P95Wait > s.P95Wait*ms {
+		return false
+	}
+	if s.MeanWait > 0 && step.MeanWait > s.MeanWait*ms {
+		return false
+	}
+	return step.DeadlineMisses <= s.MaxDeadlineMisses && step.Unfinished <= s.MaxUnfinished
+}
+
+func limitsKey(limits map[string]int) string {
+	clouds := make([]string, 0, len(limits))
+	for cloud := range limits {
+		clouds = append(clouds, cloud)
+	}
+	sort.Strings(clouds)
+	parts := make([]string, 0, len(clouds))
+	for _, cloud := range clouds {
+		parts = append(parts, cloud+"="+strconv.Itoa(limits[cloud]))
+	}
+	return strings.Join(parts, ",")
+}
+
+func (p *planner) status() Plan {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	plan := p.plan
+	plan.Steps = append([]PlanStep(nil), p.plan.Steps...)
+	return plan
+}
+
+// planHandle starts a capacity planner, its progress and result are polled at the returned location
+func (sim *Simulator) planHandle(w http.ResponseWriter, r *http.Request) {
+	sim.Log.Print("PlanRequest: /metapipe/plan/")
+
+	var spec PlanSpec
+	err := json.NewDecoder(r.Body).Decode(&spec)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p, err := sim.startPlan(spec)
+	if err != nil {
+		sim.Log.Print(err)
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	plan := p.status()
+	sim.acceptBatch(w, "plan", "/metapipe/plan/", &p.batch, &plan)
+}
+
+// planStatusHandle reports the configurations the planner has simulated, and the result when it is done
+func (sim *Simulator) planStatusHandle() http.HandlerFunc {
+	return sim.batchStatusHandle("plan", func(name string) (interface{}, bool) {
+		p, ok := sim.runs().plan(name)
+		if !ok {
+			return nil, false
+		}
+		plan := p.status()
+		return &plan, true
+	})
+}
@@ -0,0 +1,184 @@
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/segmentio/ksuid"
+	"github.com/tteige/uit-go/algorithm"
+	"github.com/tteige/uit-go/autoscale"
+	"net/http"
+	"time"
+)
+
+// RunInput is everything the result of a simulation run depends on. It is stored with the run, and a run
+// started from the same input gives the same jobs, instances and events
+type RunInput struct {
+	Name       string                         `json:"name"`
+	StartTime  time.Time                      `json:"start_time"`
+	Timestep   int                            `json:"timestep"`
+	Iterations int                            `json:"iterations"`
+	Mode       string                         `json:"mode"`
+	Seed       int64                          `json:"seed"`
+	Jobs       []autoscale.AlgorithmJob       `json:"jobs"`
+	Clusters   autoscale.ClusterCollection    `json:"clusters"`
+	Algorithm  autoscale.AlgorithmSpec        `json:"algorithm"`
+	Estimator  autoscale.EstimatorSpec        `json:"estimator"`
+	Noise      map[string]autoscale.NoiseSpec `json:"noise"`
+	Dispatcher string                         `json:"dispatcher"`
+}
+
+// newRun creates the clouds and the autoscaling run of the input and stores the input with the run.
+// The defaults are filled in before the input is stored, so the stored input is exactly what was run
+func (sim *Simulator) newRun(in RunInput, alg autoscale.Algorithm) (metapipeReturn) {
+	var retVal metapipeReturn
+	if in.StartTime.IsZero() {
+		in.StartTime = defaultStartTime()
+	}
+	if in.Timestep == 0 {
+		in.Timestep = 30
+	}
+	if in.Iterations == 0 {
+		in.Iterations = 96
+	}
+	if in.Mode == "" {
+		in.Mode = EventMode
+	}
+	if in.Mode != EventMode && in.Mode != TickMode {
+		retVal.err = invalidRequest(fmt.Errorf("unknown simulation mode %q", in.Mode))
+		return retVal
+	}
+	var err error
+	//The tick mode keeps its own dispatch loop unless a dispatcher is selected, so it reproduces earlier results
+	if in.Dispatcher != "" || in.Mode == EventMode {
+		retVal.dispatcher, err = autoscale.NewDispatcher(in.Dispatcher)
+		if err != nil {
+			retVal.err = invalidRequest(err)
+			return retVal
+		}
+	}
+	in.Clusters, err = loadPrices(in.Clusters)
+	if err != nil {
+		retVal.err = invalidRequest(err)
+		return retVal
+	}
+	if in.Seed == 0 {
+		in.Seed = time.Now().UnixNano()
+	}
+	if in.Name == "" {
+		in.Name = ksuid.New().String()
+	}
+
+	retVal.hub = &eventHub{}
+	retVal.store = streamingStore{Store: sim.Store, hub: retVal.hub}
+	clouds, err := sim.createMetapipeClouds(in.Clusters, retVal.store, in.Seed)
+	if err != nil {
+		retVal.err = err
+		return retVal
+	}
+	for cloud := range in.Noise {
+		if _, ok := clouds[cloud]; !ok {
+			retVal.err = invalidRequest(fmt.Errorf("noise for unknown cloud %s", cloud))
+			return retVal
+		}
+	}
+	retVal.noise, err = newRuntimeNoise(in.Noise, in.Seed, sim.Estimator)
+	if err != nil {
+		retVal.err = invalidRequest(err)
+		return retVal
+	}
+	in.Noise = retVal.noise.resolvedSpecs()
+
+	in.Algorithm.Options = nullOptions(in.Algorithm.Options)
+	in.Estimator.Options = nullOptions(in.Estimator.Options)
+	snapshot, err := json.Marshal(&in)
+	if err != nil {
+		retVal.err = err
+		return retVal
+	}
+	retVal.id, retVal.err = sim.Store.CreateAutoscalingRun(in.Name, time.Now(), in.Algorithm)
+	if retVal.err != nil {
+		return retVal
+	}
+	retVal.err = sim.Store.InsertAutoscalingRunInput(retVal.id, snapshot)
+	if retVal.err != nil {
+		return retVal
+	}
+	setScalingIds(clouds, retVal.id)
+
+	retVal.algorithm = alg
+	retVal.input = autoscale.AlgorithmInput{Clouds: clouds}
+	retVal.jobs = append([]autoscale.AlgorithmJob(nil), in.Jobs...)
+	retVal.timestamp = in.StartTime
+	retVal.timestep = in.Timestep
+	retVal.iterations = in.Iterations
+	retVal.mode = in.Mode
+	return retVal
+}
+
+// runInput reads the stored input of a run
+func (sim *Simulator) runInput(id string) (RunInput, error) {
+	var in RunInput
+	b, err := sim.Store.GetAutoscalingRunInput(id)
+	if err != nil {
+		return in, err
+	}
+	err = json.Unmarshal(b, &in)
+	return in, err
+}
+
+// prepareReplay creates a new run from the stored input of the run id. The algorithm is created from its stored
+// spec and the jobs keep their stored execution times, so neither the estimator nor the current configuration
+// of the simulator affect the replay
+func (sim *Simulator) prepareReplay(id string) (metapipeReturn) {
+	in, err := sim.runInput(id)
+	if err != nil {
+		return metapipeReturn{err: err}
+	}
+	alg, err := algorithm.FromSpec(in.Algorithm)
+	if err != nil {
+		return metapipeReturn{err: err}
+	}
+	in.Name = id + "-replay-" + ksuid.New().String()
+	return sim.newRun(in, alg)
+}
+
+// Replay runs the run id again from its stored input and returns the output of the new run
+func (sim *Simulator) Replay(id string) (FullSimulationOutput, error) {
+	run := sim.prepareReplay(id)
+	if run.err != nil {
+		return FullSimulationOutput{}, run.err
+	}
+	res := <-sim.runs().start(run)
+	if res.err != nil {
+		return FullSimulationOutput{}, res.err
+	}
+	return sim.loadOutput(run.id)
+}
+
+// replayHandle starts a new run from the stored input of a run, it is followed like any other simulation
+func (sim *Simulator) replayHandle(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	sim.Log.Printf("ReplayRequest: /metapipe/simulation/%s/replay", id)
+
+	if _, err := sim.Store.GetAutoscalingRunInput(id); err != nil {
+		http.Error(w, "no stored input for simulation "+id, http.StatusNotFound)
+		return
+	}
+	run := sim.prepareReplay(id)
+	if run.err != nil {
+		sim.Log.Print(run.err)
+		http.Error(w, run.err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sim.acceptRun(w, run)
+}
+
+// nullOptions gives nil for options that are empty or null. Empty options can not be encoded as JSON, and the
+// null read back from a stored input would otherwise be stored as the options of the replay
+func nullOptions(options json.RawMessage) json.RawMessage {
+	if len(options) == 0 || string(options) == "null" {
+		return nil
+	}
+	return options
+}
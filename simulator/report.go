@@ -0,0 +1,141 @@
+package simulator
+
+import (
+	"github.com/tteige/uit-go/autoscale"
+	"math"
+	"sort"
+	"time"
+)
+
+// CloudMetrics is the outcome of a run on a cloud. The cost is billed under the billing model of the instance
+// types from an instance is created until it is terminated or the run ends, and the idle cost is the price of
+// the time the instances were IDLE. The times are in milliseconds and waits are counted from the job arrived
+// until it started, or until the run ended for jobs that never started
+type CloudMetrics struct {
+	BilledCost        float64 `json:"billed_cost"`
+	IdleCost          float64 `json:"idle_cost"`
+	Makespan          int64   `json:"makespan"`
+	MeanWait          float64 `json:"mean_wait"`
+	P95Wait           float64 `json:"p95_wait"`
+	Finished          int     `json:"finished"`
+	Unfinished        int     `json:"unfinished"`
+	DeadlineMisses    int     `json:"deadline_misses"`
+	InstanceHours     float64 `json:"instance_hours"`
+	IdleInstanceHours float64 `json:"idle_instance_hours"`
+}
+
+// end is the time of the last algorithm iteration, the simulation stops there
+func (in RunInput) end() time.Time {
+	if in.Iterations < 1 {
+		return in.StartTime
+	}
+	return in.StartTime.Add(time.Minute * time.Duration(in.Timestep*(in.Iterations-1)))
+}
+
+// runMetrics reads the input and output of a finished run and computes its metrics
+func (sim *Simulator) runMetrics(id string) (map[string]CloudMetrics, CloudMetrics, error) {
+	in, err := sim.runInput(id)
+	if err != nil {
+		return nil, CloudMetrics{}, err
+	}
+	out, err := sim.loadOutput(id)
+	if err != nil {
+		return nil, CloudMetrics{}, err
+	}
+	clouds, total := computeMetrics(in, out)
+	return clouds, total, nil
+}
+
+// computeMetrics computes the metrics of every cloud of a finished run, and of all clouds together
+func computeMetrics(in RunInput, out FullSimulationOutput) (map[string]CloudMetrics, CloudMetrics) {
+	start := in.StartTime
+	end := in.end()
+	bill := billRun(in.Clusters, out.CloudEvents, start, end)
+	clouds := make(map[string]CloudMetrics)
+	waits := make(map[string][]float64)
+	var allWaits []float64
+	var total CloudMetrics
+	for key := range in.Clusters {
+		clouds[key] = CloudMetrics{}
+	}
+
+	for _, o := range jobOutcomes(in, out.Jobs) {
+		m := clouds[o.Cloud]
+		if o.State == autoscale.FINISHED {
+			m.Finished++
+			if makespan := int64(o.Finished.Sub(start) / time.Millisecond); makespan > m.Makespan {
+				m.Makespan = makespan
+			}
+		} else {
+			m.Unfinished++
+		}
+		if !o.DeadlineMet {
+			m.DeadlineMisses++
+		}
+		clouds[o.Cloud] = m
+		waits[o.Cloud] = append(waits[o.Cloud], float64(o.Wait))
+		allWaits = append(allWaits, float64(o.Wait))
+	}
+
+	keys := make([]string, 0, len(clouds))
+	for key := range clouds {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		m := clouds[key]
+		if cluster, ok := in.Clusters[key]; ok {
+			b := bill.Clouds[cluster.Name]
+			m.BilledCost = b.Cost
+			m.IdleCost = b.IdleCost
+			m.InstanceHours = b.InstanceHours
+			m.IdleInstanceHours = b.IdleInstanceHours
+		}
+		m.MeanWait = mean(waits[key])
+		m.P95Wait = percentile(waits[key], 95)
+		clouds[key] = m
+
+		total.BilledCost += m.BilledCost
+		total.IdleCost += m.IdleCost
+		total.InstanceHours += m.InstanceHours
+		total.IdleInstanceHours += m.IdleInstanceHours
+		total.Finished += m.Finished
+		total.Unfinished += m.Unfinished
+		total.DeadlineMisses += m.DeadlineMisses
+		if m.Makespan > total.Makespan {
+			total.Makespan = m.Makespan
+		}
+	}
+	total.MeanWait = mean(allWaits)
+	total.P95Wait = percentile(allWaits, 95)
+	//Untagged jobs that never started belong to no cloud, they are only counted in the total
+	if _, ok := in.Clusters[""]; !ok {
+		delete(clouds, "")
+	}
+	return clouds, total
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// percentile is the nearest rank p percentile of the values
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
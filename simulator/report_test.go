@@ -0,0 +1,70 @@
+package simulator
+
+import (
+	"github.com/tteige/uit-go/autoscale"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	values := []float64{15, 20, 35, 40, 50}
+	tests := []struct {
+		values []float64
+		p      float64
+		want   float64
+	}{
+		{nil, 50, 0},
+		{[]float64{7}, 99, 7},
+		{values, 0, 15},
+		{values, 5, 15},
+		{values, 30, 20},
+		{values, 40, 20},
+		{values, 50, 35},
+		{values, 100, 50},
+		{[]float64{50, 15, 40, 20, 35}, 50, 35},
+	}
+	for i, test := range tests {
+		if got := percentile(test.values, test.p); got != test.want {
+			t.Errorf("%d: percentile(%v, %v) = %v, want %v", i, test.values, test.p, got, test.want)
+		}
+	}
+	if values[0] != 15 || values[4] != 50 {
+		t.Error("percentile changed the order of the values")
+	}
+}
+
+func TestJobOutcomes(t *testing.T) {
+	start := time.Date(2017, 11, 24, 0, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time {
+		return start.Add(time.Duration(minutes) * time.Minute)
+	}
+	hour := map[string]int64{"aws": 3600000}
+	in := RunInput{StartTime: start, Timestep: 60, Iterations: 11}
+	jobs := []autoscale.AlgorithmJob{
+		{Id: "waited", Tag: "aws", State: autoscale.FINISHED, Created: at(0), Started: at(60), ExecutionTime: hour, Deadline: at(90)},
+		{Id: "before", Tag: "aws", State: autoscale.FINISHED, Created: at(-120), Started: at(-30), ExecutionTime: hour},
+		{Id: "queued", Tag: "aws", State: autoscale.QUEUED, Created: at(300), ExecutionTime: hour, Deadline: at(660)},
+		{Id: "late", Tag: "aws", State: autoscale.QUEUED, Created: at(300), ExecutionTime: hour, Deadline: at(400)},
+	}
+	want := map[string]JobOutcome{
+		"waited": {Wait: 3600000, Turnaround: 7200000, Slowdown: 2, DeadlineMet: false},
+		//A job that was running when the run started did not wait in the run
+		"before": {Wait: 0, Turnaround: 1800000, Slowdown: 1, DeadlineMet: true},
+		"queued": {Wait: 18000000, DeadlineMet: true},
+		"late":   {Wait: 18000000, DeadlineMet: false},
+	}
+	outcomes := jobOutcomes(in, jobs)
+	if len(outcomes) != len(jobs) {
+		t.Fatalf("got %d outcomes, want %d", len(outcomes), len(jobs))
+	}
+	if outcomes[0].JobId != "before" {
+		t.Errorf("the first outcome is %s, want the first submitted job", outcomes[0].JobId)
+	}
+	for _, o := range outcomes {
+		w := want[o.JobId]
+		if o.Wait != w.Wait || o.Turnaround != w.Turnaround || o.Slowdown != w.Slowdown || o.DeadlineMet != w.DeadlineMet {
+			t.Errorf("%s: got wait %d, turnaround %d, slowdown %v, deadline met %v, want %+v",
+				o.JobId, o.Wait, o.Turnaround, o.Slowdown, o.DeadlineMet, w)
+		}
+	}
+}
@@ -9,48 +9,87 @@ import (
 	"log"
 	"html/template"
 	"github.com/tteige/uit-go/models"
-	"github.com/segmentio/ksuid"
 	"encoding/json"
 	"net/url"
 	"io"
 	"github.com/tteige/uit-go/metapipe"
 	"sort"
+	"github.com/tteige/uit-go/algorithm"
+	"sync"
+	"context"
+	"github.com/tteige/uit-go/workload"
+	"github.com/tteige/uit-go/swf"
+	"strings"
 )
 
 type simulationOutput map[int]map[string][]autoscale.AlgorithmJob
-type fullSimulationOutput struct {
+type FullSimulationOutput struct {
 	Name        string                   `json:"name"`
 	Jobs        []autoscale.AlgorithmJob `json:"jobs"`
 	SimEvents   []models.SimulatorEvent  `json:"sim_events"`
 	CloudEvents []models.CloudEvent      `json:"cloud_events"`
+	Assignments []models.JobAssignment   `json:"assignments"`
+	Snapshots   []models.ClusterSnapshot `json:"snapshots"`
+	// Outcomes and Bill are only set for runs with a stored input
+	Outcomes *RunOutcomes `json:"outcomes,omitempty"`
+	Bill     *Bill        `json:"bill,omitempty"`
 }
 
 type Simulator struct {
-	DB          *sql.DB
+	Store       models.Store
 	Hostname    string
 	SimClusters autoscale.ClusterCollection
-	Algorithm   autoscale.Algorithm
-	Log         *log.Logger
-	templates   *template.Template
-	tmplLoc     string
-	Estimator   autoscale.Estimator
+	// Algorithm is used when a request does not select one, AlgorithmSpec describes it
+	Algorithm     autoscale.Algorithm
+	AlgorithmSpec autoscale.AlgorithmSpec
+	// EstimatorSpec describes the Estimator, it is stored with the input of every run
+	EstimatorSpec autoscale.EstimatorSpec
+	Log           *log.Logger
+	templates     *template.Template
+	tmplLoc       string
+	Estimator     autoscale.Estimator
+	// MaxConcurrentRuns limits the simulations running at the same time, the number of CPUs if zero
+	MaxConcurrentRuns int
+	manager           *runManager
+	managerOnce       sync.Once
 }
 
+// Simulation modes, EventMode runs the discrete event engine and TickMode the fixed timestep loop
+// of the first simulator versions
+const (
+	EventMode = "event"
+	TickMode  = "tick"
+)
+
+// JobLost is the state of a job assignment whose instance crashed while it ran the job
+const JobLost = "LOST"
+
 type metapipeReturn struct {
 	id         string
+	algorithm  autoscale.Algorithm
 	input      autoscale.AlgorithmInput
 	jobs       []autoscale.AlgorithmJob
 	timestamp  time.Time
 	err        error
 	iterations int
 	timestep   int
+	mode       string
+	noise      *runtimeNoise
+	// dispatcher starts the queued jobs, it is nil for tick mode runs that keep the old dispatch loop
+	dispatcher autoscale.Dispatcher
+	// store is the store of the run, it publishes the events of the run to hub
+	store models.Store
+	hub   *eventHub
+	// ctx stops the simulation when it is cancelled, progress is called after each algorithm iteration
+	ctx      context.Context
+	progress func(iteration int)
 }
 
 func (sim *Simulator) Run() {
 	sim.Log.Printf("Starting the auto scaling simulator at: %s ", sim.Hostname)
 	sim.tmplLoc = "simulator/templates/"
 	sim.templates = template.Must(template.ParseFiles(sim.tmplLoc+"footer.html", sim.tmplLoc+"header.html",
-		sim.tmplLoc+"index.html", sim.tmplLoc+"navbar.html"))
+		sim.tmplLoc+"index.html", sim.tmplLoc+"navbar.html", sim.tmplLoc+"comparison.html", sim.tmplLoc+"gantt.html"))
 	err := sim.Estimator.Init()
 	if err != nil {
 		sim.Log.Fatal(err)
@@ -65,12 +104,28 @@ func (sim *Simulator) serveSim() {
 	r.HandleFunc("/metapipe/simulate/", sim.metapipeSimulationHandle).Methods("POST")
 	r.HandleFunc("/metapipe/simulation/", sim.getPreviousScalingHandle).Methods("GET")
 	r.HandleFunc("/metapipe/simulation/all", sim.getAllSimulations).Methods("GET")
+	r.HandleFunc("/metapipe/simulation/{id}", sim.simulationStatusHandle).Methods("GET")
+	r.HandleFunc("/metapipe/simulation/{id}", sim.cancelSimulationHandle).Methods("DELETE")
+	r.HandleFunc("/metapipe/simulation/{id}/events", sim.simulationEventsHandle).Methods("GET")
+	r.HandleFunc("/metapipe/simulation/{id}/replay", sim.replayHandle).Methods("POST")
+	r.HandleFunc("/metapipe/simulation/{id}/swf", sim.swfExportHandle).Methods("GET")
+	r.HandleFunc("/metapipe/simulation/{id}/bill", sim.billHandle).Methods("GET")
+	r.HandleFunc("/metapipe/simulation/{id}/assignments", sim.assignmentsHandle).Methods("GET")
+	r.Handle("/metapipe/montecarlo/{name}", sim.monteCarloStatusHandle()).Methods("GET")
+	r.Handle("/metapipe/comparison/{name}", sim.comparisonStatusHandle()).Methods("GET")
+	r.HandleFunc("/comparison/{name}", sim.comparisonPageHandle).Methods("GET")
+	r.HandleFunc("/gantt/{id}", sim.ganttPageHandle).Methods("GET")
+	r.HandleFunc("/metapipe/sweep/", sim.sweepHandle).Methods("POST")
+	r.HandleFunc("/metapipe/sweep/{name}", sim.sweepSummaryHandle).Methods("GET")
+	r.HandleFunc("/metapipe/sweep/{name}/csv", sim.sweepCSVHandle).Methods("GET")
+	r.HandleFunc("/metapipe/plan/", sim.planHandle).Methods("POST")
+	r.Handle("/metapipe/plan/{name}", sim.planStatusHandle()).Methods("GET")
 	http.ListenAndServe(sim.Hostname, r)
 }
 
 func (sim *Simulator) getAllSimulations(w http.ResponseWriter, r *http.Request) {
 	sim.Log.Print("GetAllSimulationsRequest: /simulation/all")
-	runs, err := models.GetAllAutoscalingRunStats(sim.DB)
+	runs, err := sim.Store.GetAllAutoscalingRunStats()
 	if err != nil {
 		sim.Log.Print(err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -89,45 +144,143 @@ func (sim *Simulator) getPreviousScalingHandle(w http.ResponseWriter, r *http.Re
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	var out fullSimulationOutput
+	var out FullSimulationOutput
 	q := raw.Query()
 	if val, ok := q["id"]; ok {
 		sim.Log.Printf("GetAllSimulationsRequest: /metapipe/simulation/?id=%s", q["id"])
-		events, err := models.GetAutoscalingRunEvents(sim.DB, val[0])
-		if err != nil && err != sql.ErrNoRows {
-			sim.Log.Print(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		out.CloudEvents = events
-
-		simEvents, err := models.GetSimulatorEvents(sim.DB, val[0])
-		if err != nil && err != sql.ErrNoRows {
-			sim.Log.Print(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		out.SimEvents = simEvents
-
-		jobs, err := models.GetAllAlgorithmJobs(sim.DB, val[0])
-		if err != nil && err != sql.ErrNoRows {
+		out, err = sim.loadOutput(val[0])
+		if err != nil {
 			sim.Log.Print(err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		out.Jobs = jobs
-		out.Name = val[0]
 	}
 
 	b, err := json.Marshal(out)
 	w.Write(b)
 }
 
-func (sim *Simulator) simulate(simId string, completeQueue []autoscale.AlgorithmJob, algInput autoscale.AlgorithmInput, algTimestamp time.Time, timestep int, iterations int) (simulationOutput, error) {
+// swfExportHandle writes the finished jobs of a run as an SWF trace
+func (sim *Simulator) swfExportHandle(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	sim.Log.Printf("SWFExportRequest: /metapipe/simulation/%s/swf", id)
+
+	jobs, err := sim.Store.GetAllAlgorithmJobs(id)
+	if err != nil && err != sql.ErrNoRows {
+		sim.Log.Print(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+id+".swf\"")
+	err = swf.Write(w, jobs, "simulation "+id)
+	if err != nil {
+		sim.Log.Print(err)
+	}
+}
+
+func (sim *Simulator) loadOutput(id string) (FullSimulationOutput, error) {
+	out := FullSimulationOutput{Name: id}
+	events, err := sim.Store.GetAutoscalingRunEvents(id)
+	if err != nil && err != sql.ErrNoRows {
+		return out, err
+	}
+	out.CloudEvents = events
+
+	simEvents, err := sim.Store.GetSimulatorEvents(id)
+	if err != nil && err != sql.ErrNoRows {
+		return out, err
+	}
+	out.SimEvents = simEvents
+
+	jobs, err := sim.Store.GetAllAlgorithmJobs(id)
+	if err != nil && err != sql.ErrNoRows {
+		return out, err
+	}
+	out.Jobs = jobs
+
+	assignments, err := sim.Store.GetJobAssignments(id)
+	if err != nil && err != sql.ErrNoRows {
+		return out, err
+	}
+	out.Assignments = assignments
+
+	snapshots, err := sim.Store.GetClusterSnapshots(id)
+	if err != nil && err != sql.ErrNoRows {
+		return out, err
+	}
+	out.Snapshots = snapshots
+
+	in, err := sim.runInput(id)
+	if err == nil {
+		outcomes := runOutcomes(in, jobs)
+		out.Outcomes = &outcomes
+		bill := billRun(in.Clusters, events, in.StartTime, in.end())
+		out.Bill = &bill
+	}
+	return out, nil
+}
+
+// Simulate runs a simulation without the HTTP server and returns its stored output
+func (sim *Simulator) Simulate(input metapipe.ScalingRequestInput) (FullSimulationOutput, error) {
+	run := sim.prepareRun(input)
+	if run.err != nil {
+		return FullSimulationOutput{}, run.err
+	}
+	res := <-sim.runs().start(run)
+	if res.err != nil {
+		return FullSimulationOutput{}, res.err
+	}
+	return sim.loadOutput(run.id)
+}
+
+func (sim *Simulator) runs() *runManager {
+	sim.managerOnce.Do(func() {
+		sim.manager = newRunManager(sim, sim.MaxConcurrentRuns)
+	})
+	return sim.manager
+}
+
+func (sim *Simulator) simulate(run metapipeReturn) (simulationOutput, error) {
+	sim.Log.Printf("Starting simulation: %s (%s mode)", run.id, run.mode)
+	if run.ctx == nil {
+		run.ctx = context.Background()
+	}
+	if run.progress == nil {
+		run.progress = func(int) {}
+	}
+	var out simulationOutput
+	var err error
+	if run.mode == TickMode {
+		out, err = sim.simulateTicks(run)
+	} else {
+		out, err = sim.simulateEvents(run)
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = sim.endRun(run)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// simulateTicks runs the algorithm every timestep minutes, jobs are only started and finished at these ticks
+func (sim *Simulator) simulateTicks(run metapipeReturn) (simulationOutput, error) {
 	jsonSimQueue := make(simulationOutput)
-	sim.Log.Printf("Starting simulation: %s", simId)
+	simId := run.id
+	alg := run.algorithm
+	completeQueue := run.jobs
+	algInput := run.input
+	algTimestamp := run.timestamp
+	timestep := run.timestep
+	iterations := run.iterations
 
 	for i := 0; i < iterations; i++ {
+		if err := run.ctx.Err(); err != nil {
+			return nil, err
+		}
 		if i > 0 {
 			//Simulates a 30 minute interval between each scaling attempt
 			algTimestamp = algTimestamp.Add(time.Minute * time.Duration(timestep))
@@ -149,18 +302,47 @@ func (sim *Simulator) simulate(simId string, completeQueue []autoscale.Algorithm
 			queueMapBefore[j.Tag] = append(queueMapBefore[j.Tag], j)
 		}
 		totalCostBeforeMap := make(map[string]float64)
-		for key, queueBefore := range queueMapBefore {
+		for _, key := range autoscale.SortedTags(queueMapBefore) {
 			if key == "" {
 				continue
 			}
-			totalCostBeforeMap[key] = algInput.Clouds[key].GetTotalCost(queueBefore, algTimestamp)
+			totalCostBeforeMap[key] = algInput.Clouds[key].GetTotalCost(queueMapBefore[key], algTimestamp)
+		}
+
+		//Move booting and draining instances forward before the algorithm sees them
+		for _, key := range algInput.Clouds.Names() {
+			if simCloud, ok := algInput.Clouds[key].(*SimCloud); ok {
+				err := simCloud.Advance(algTimestamp)
+				if err != nil {
+					return nil, err
+				}
+				lost := requeueLostJobs(algInput.JobQueue, key, simCloud.takeLost())
+				err = sim.recordLostJobs(run, lost, algTimestamp)
+				if err != nil {
+					return nil, err
+				}
+			}
 		}
 
 		//Run the algorithm
-		out, err := sim.Algorithm.Run(algInput, algTimestamp)
+		out, err := alg.Run(algInput, algTimestamp)
+		if err != nil {
+			return nil, err
+		}
+		out.Instances, err = autoscale.ApplyActions(algInput.Clouds, out.Actions, algTimestamp)
 		if err != nil {
 			return nil, err
 		}
+		//Creating or deleting instances advances the clouds, instances can crash while the actions are applied
+		for _, key := range algInput.Clouds.Names() {
+			if simCloud, ok := algInput.Clouds[key].(*SimCloud); ok {
+				lost := requeueLostJobs(out.JobQueue, key, simCloud.takeLost())
+				err = sim.recordLostJobs(run, lost, algTimestamp)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
 
 		//Split the output to queues defined by tag
 		queueMap := make(map[string][]autoscale.AlgorithmJob)
@@ -172,31 +354,36 @@ func (sim *Simulator) simulate(simId string, completeQueue []autoscale.Algorithm
 		newInputQueue := make([]autoscale.AlgorithmJob, 0)
 
 		//Iterate the queues in the map
-		for key, queue := range queueMap {
-			if _, ok := algInput.Clouds[key]; !ok {
+		for _, key := range autoscale.SortedTags(queueMap) {
+			queue := queueMap[key]
+			cloud, ok := algInput.Clouds[key].(*SimCloud)
+			if !ok {
 				continue
 			}
-			instances, err := algInput.Clouds[key].GetInstances()
+			instances, err := cloud.GetInstances()
 			if err != nil {
 				return nil, err
 			}
 
-			instancesInactive := 0
-			instancesActive := 0
+			//Booting instances can not run jobs yet, draining instances only run the job they already have
+			instancesIdle := 0
+			instancesBusy := 0
 			for _, i := range instances {
-				if i.State == autoscale.ACTIVE {
-					instancesActive++
-				} else {
-					instancesInactive++
+				switch i.State {
+				case autoscale.IDLE:
+					instancesIdle++
+				case autoscale.BUSY:
+					instancesBusy++
+				case autoscale.DRAINING:
+					if i.TerminateAt.IsZero() {
+						instancesBusy++
+					}
 				}
 			}
 			runningJobs := 0
-			notRunningJobs := 0
 			for _, i := range queue {
 				if i.State == autoscale.RUNNING {
 					runningJobs++
-				} else {
-					notRunningJobs++
 				}
 			}
 
@@ -212,62 +399,63 @@ func (sim *Simulator) simulate(simId string, completeQueue []autoscale.Algorithm
 			for k := range queue {
 				j := k - deleted
 				//Simulate the job manager launching the job on the correct cluster
-				if instancesActive > runningJobs {
-					if queue[j].State != autoscale.RUNNING {
-						queue[j].State = autoscale.RUNNING
-						runningJobs++
-						notRunningJobs--
-						queue[j].Started = algTimestamp
-					}
-				} else if instancesInactive != 0 {
-					if queue[j].State != autoscale.RUNNING {
+				if run.dispatcher == nil && queue[j].State != autoscale.RUNNING {
+					if instancesBusy > runningJobs {
 						queue[j].State = autoscale.RUNNING
 						queue[j].Started = algTimestamp
+						queue[j].InstanceId = unassignedInstance(cloud, queue)
 						runningJobs++
-						notRunningJobs--
-						for index := range instances {
-							if instances[index].State == autoscale.INACTIVE {
-								instances[index].State = autoscale.ACTIVE
-								instancesInactive--
-								instancesActive++
-								break
-							}
+					} else if instancesIdle != 0 {
+						id, err := cloud.AcquireInstance("", algTimestamp)
+						if err != nil {
+							return nil, err
+						}
+						if id != "" {
+							queue[j].State = autoscale.RUNNING
+							queue[j].Started = algTimestamp
+							queue[j].InstanceId = id
+							runningJobs++
+							instancesIdle--
+							instancesBusy++
 						}
 					}
 				}
 				//Simulates a job finishing
-				t := queue[j].Started.Add(time.Duration(time.Millisecond * time.Duration(queue[j].ExecutionTime[queue[j].Tag])))
+				t := queue[j].Started.Add(time.Duration(time.Millisecond * time.Duration(run.noise.executionTime(queue[j]))))
 				if t.Before(algTimestamp) && queue[j].State == autoscale.RUNNING {
 					queue[j].State = autoscale.FINISHED
-					instanceIndex := 0
-					for _, instance := range instances {
-						if instance.State == autoscale.ACTIVE {
-							if queue[j].InstanceFlavour != "" {
-								if queue[j].InstanceFlavour == instances[instanceIndex].Type {
-									break
-								}
-							} else {
-								break
-							}
-						}
-						instanceIndex++
+					id, err := cloud.ReleaseInstance(queue[j].InstanceId, queue[j].InstanceFlavour, algTimestamp)
+					if err != nil {
+						return nil, err
 					}
-					if instanceIndex < len(instances) && instances[instanceIndex].State == autoscale.ACTIVE {
-						instances[instanceIndex].State = autoscale.INACTIVE
+					if id != "" {
+						instancesBusy--
+						runningJobs--
+						err = sim.recordJob(run, queue[j], algTimestamp)
+						if err != nil {
+							return nil, err
+						}
 						queue = queue[:j+copy(queue[j:], queue[j+1:])]
 						deleted++
 					} else {
-						sim.Log.Println("Something went wrong with the simulation of job state transition. No active instances found")
+						sim.Log.Println("Something went wrong with the simulation of job state transition. No busy instances found")
 					}
 				}
 			}
+			//A selected dispatcher starts the jobs on the instances left after the jobs that finished
+			if run.dispatcher != nil {
+				_, err = startJobs(run.dispatcher, cloud, key, queue, algTimestamp)
+				if err != nil {
+					return nil, err
+				}
+			}
 
 			dur, err := algInput.Clouds[key].GetTotalDuration(queue, algTimestamp)
 			if err != nil {
 				return nil, err
 			}
 			queueCost := algInput.Clouds[key].GetTotalCost(queue, algTimestamp)
-			err = models.InsertSimulatorEvent(sim.DB, models.SimulatorEvent{
+			err = sim.insertSimulatorEvent(run, models.SimulatorEvent{
 				RunName:            simId,
 				QueueDuration:      dur,
 				AlgorithmTimestamp: algTimestamp,
@@ -281,20 +469,24 @@ func (sim *Simulator) simulate(simId string, completeQueue []autoscale.Algorithm
 
 			for _, jobAfterDelete := range queue {
 				newInputQueue = append(newInputQueue, jobAfterDelete)
-				//err = models.InsertAlgorithmJob(sim.DB, jobAfterDelete, simId)
-				if err != nil {
-					return nil, err
-				}
 			}
 
 			resp[key] = queue
 		}
 		jsonSimQueue[i] = resp
 		algInput.JobQueue = newInputQueue
+		err = sim.recordSnapshots(run, algInput.Clouds, newInputQueue, algTimestamp)
+		if err != nil {
+			return nil, err
+		}
+		run.progress(i + 1)
 	}
-	err := sim.endRun(simId)
-	if err != nil {
-		return nil, err
+	end := run.timestamp.Add(time.Minute * time.Duration(run.timestep*(run.iterations-1)))
+	for _, job := range algInput.JobQueue {
+		err := sim.recordJob(run, job, end)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return jsonSimQueue, nil
 }
@@ -302,33 +494,164 @@ func (sim *Simulator) simulate(simId string, completeQueue []autoscale.Algorithm
 func (sim *Simulator) metapipeSimulationHandle(w http.ResponseWriter, r *http.Request) {
 	sim.Log.Print("SimulationRequest: /metapipe/simulate/")
 
-	metaOutput := sim.handleMetapipe(r)
+	reqInput, err := decodeScalingRequest(r)
+	if err != nil {
+		sim.Log.Print(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(reqInput.Compare) > 0 {
+		sim.compareHandle(w, reqInput)
+		return
+	}
+	if reqInput.MonteCarloRuns > 0 {
+		sim.monteCarloHandle(w, reqInput)
+		return
+	}
+	metaOutput := sim.prepareRun(reqInput)
 	if metaOutput.err != nil {
 		sim.Log.Print(metaOutput.err)
-		http.Error(w, metaOutput.err.Error(), http.StatusInternalServerError)
+		http.Error(w, metaOutput.err.Error(), errorStatus(metaOutput.err))
+		return
+	}
+	sim.acceptRun(w, metaOutput)
+}
+
+// acceptRun starts the run in the background and responds with its location
+func (sim *Simulator) acceptRun(w http.ResponseWriter, run metapipeReturn) {
+	done := sim.runs().start(run)
+	go func() {
+		res := <-done
+		if res.err != nil {
+			sim.Log.Printf("Simulation %s stopped: %s", run.id, res.err)
+			return
+		}
+		sim.Log.Printf("FINISHED SIMULATION %s", run.id)
+	}()
+
+	//The simulation can run longer than the request timeout of a proxy, so the client polls the run location instead
+	status, _ := sim.runs().status(run.id)
+	w.Header().Set("Location", "/metapipe/simulation/"+url.PathEscape(run.id))
+	w.WriteHeader(http.StatusAccepted)
+	enc := json.NewEncoder(w)
+	enc.Encode(&status)
+}
+
+// simulationStatusHandle reports if the run is queued, running, finished or failed
+func (sim *Simulator) simulationStatusHandle(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	sim.Log.Printf("SimulationStatusRequest: /metapipe/simulation/%s", id)
+
+	status, err := sim.runStatus(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "unknown simulation "+id, http.StatusNotFound)
 		return
 	}
-	jsonSimQueue, err := sim.simulate(metaOutput.id, metaOutput.jobs, metaOutput.input, metaOutput.timestamp, metaOutput.timestep, metaOutput.iterations)
 	if err != nil {
 		sim.Log.Print(err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	sim.Log.Println("FINISHED SIMULATION")
-
-	w.WriteHeader(http.StatusCreated)
 	enc := json.NewEncoder(w)
-	err = enc.Encode(&jsonSimQueue)
+	enc.Encode(&status)
 }
 
-func (sim *Simulator) endRun(id string) error {
-	err := models.UpdateAutoscalingRun(sim.DB, id, time.Now())
+func (sim *Simulator) runStatus(id string) (RunStatus, error) {
+	status, ok := sim.runs().status(id)
+	if ok {
+		return status, nil
+	}
+	//Runs of an earlier process are only known by the store, a run that never finished was interrupted
+	run, err := sim.Store.GetAutoscalingRun(id)
+	if err != nil {
+		return RunStatus{}, err
+	}
+	status = RunStatus{Id: id, State: RunFailed}
+	if in, err := sim.runInput(id); err == nil {
+		status.Iterations = in.Iterations
+	}
+	if run.Finished.Valid {
+		status.State = RunFinished
+		status.Iteration = status.Iterations
+	}
+	return status, nil
+}
+
+// cancelSimulationHandle stops a queued or running simulation
+func (sim *Simulator) cancelSimulationHandle(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	sim.Log.Printf("CancelSimulationRequest: /metapipe/simulation/%s", id)
+
+	_, err := sim.runStatus(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "unknown simulation "+id, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		sim.Log.Print(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !sim.runs().cancel(id) {
+		http.Error(w, "simulation "+id+" is already done", http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (sim *Simulator) endRun(run metapipeReturn) error {
+	err := run.store.UpdateAutoscalingRun(run.id, time.Now())
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+func (sim *Simulator) insertSimulatorEvent(run metapipeReturn, event models.SimulatorEvent) error {
+	return run.store.InsertSimulatorEvent(event)
+}
+
+// recordJob stores the final state of a job at the time it finishes or the simulation ends. A finished job is
+// stored with its actual execution time, and a job that was started with the assignment of its last attempt
+func (sim *Simulator) recordJob(run metapipeReturn, job autoscale.AlgorithmJob, at time.Time) error {
+	if job.State == autoscale.FINISHED {
+		job.ExecutionTime = map[string]int64{job.Tag: run.noise.executionTime(job)}
+	}
+	err := run.store.InsertAlgorithmJob(job, run.id)
+	if err != nil {
+		return err
+	}
+	if job.State == autoscale.FINISHED || job.State == autoscale.RUNNING {
+		return sim.recordAssignment(run, job, at, job.State)
+	}
+	return nil
+}
+
+// recordLostJobs stores the assignments of the attempts that were lost with their instances at
+func (sim *Simulator) recordLostJobs(run metapipeReturn, lost []autoscale.AlgorithmJob, at time.Time) error {
+	for _, job := range lost {
+		err := sim.recordAssignment(run, job, at, JobLost)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sim *Simulator) recordAssignment(run metapipeReturn, job autoscale.AlgorithmJob, end time.Time, state string) error {
+	return run.store.InsertJobAssignment(models.JobAssignment{
+		RunName:    run.id,
+		JobId:      job.Id,
+		Attempt:    job.Attempts,
+		Cloud:      job.Tag,
+		InstanceId: job.InstanceId,
+		Priority:   job.Priority,
+		Start:      job.Started,
+		End:        end,
+		State:      state,
+	})
+}
+
 func (sim *Simulator) indexHandle(w http.ResponseWriter, r *http.Request) {
 	sim.Log.Print("IndexRequest: /")
 	err := sim.renderTemplate(w, "index", []string{})
@@ -351,92 +674,147 @@ func setScalingIds(clouds autoscale.CloudCollection, id string) {
 	}
 }
 
-func (sim *Simulator) createMetapipeClouds(inClusterStates autoscale.ClusterCollection) (autoscale.CloudCollection, error) {
+// createMetapipeClouds creates the clouds of a single run from a copy of the cluster states
+func (sim *Simulator) createMetapipeClouds(clusters autoscale.ClusterCollection, store models.Store, seed int64) (autoscale.CloudCollection, error) {
 	simCloudMap := make(autoscale.CloudCollection)
+	inClusterStates := clusters.Copy()
 
-	simCloudMap[metapipe.CPouta] = &SimCloud{
-		Cluster: inClusterStates[metapipe.CPouta],
-		Db:      sim.DB,
-	}
-	simCloudMap[metapipe.AWS] = &SimCloud{
-		Cluster: inClusterStates[metapipe.AWS],
-		Db:      sim.DB,
-	}
-	simCloudMap[metapipe.Stallo] = &SimCloud{
-		Cluster: inClusterStates[metapipe.Stallo],
-		Db:      sim.DB,
+	for _, key := range []string{metapipe.CPouta, metapipe.AWS, metapipe.Stallo} {
+		simCloudMap[key] = newSimCloud(inClusterStates[key], store, deriveSeed(seed, key))
 	}
 	return simCloudMap, nil
 }
 
-func (sim *Simulator) handleMetapipe(r *http.Request) (metapipeReturn) {
-	utcNorway := int((time.Hour).Seconds())
-	nor := time.FixedZone("Norway", utcNorway)
-	defaultTime := time.Date(2018, 5, 23, 20, 40, 23, 0, nor)
-	jobs := metapipe.GetMetapipeJobs(defaultTime.Add(time.Duration(time.Minute * -5)))
-	var algInput autoscale.AlgorithmInput
-	var simC autoscale.CloudCollection
+func decodeScalingRequest(r *http.Request) (metapipe.ScalingRequestInput, error) {
 	var reqInput metapipe.ScalingRequestInput
-	var retVal metapipeReturn
-
 	dec := json.NewDecoder(r.Body)
 	err := dec.Decode(&reqInput)
 	if err != nil && err != io.EOF {
-		return retVal
+		return reqInput, err
 	}
+	return reqInput, nil
+}
 
-	if reqInput.Clusters != nil {
-		simC, err = sim.createMetapipeClouds(reqInput.Clusters)
-		if err != nil {
-			return retVal
-		}
-	} else {
-		simC, err = sim.createMetapipeClouds(sim.SimClusters)
-		if err != nil {
-			return retVal
-		}
+// requestError is an error in a simulation request rather than in the simulator, it is answered with 400 Bad Request
+type requestError struct {
+	err error
+}
+
+func (e requestError) Error() string {
+	return e.err.Error()
+}
+
+// invalidRequest marks err as an error in the request
+func invalidRequest(err error) error {
+	return requestError{err: err}
+}
+
+// errorStatus is the HTTP status of an error, 400 for the errors in the request and 500 for the others
+func errorStatus(err error) int {
+	if _, ok := err.(requestError); ok {
+		return http.StatusBadRequest
 	}
+	return http.StatusInternalServerError
+}
 
-	algInput.Clouds = simC
+func defaultStartTime() time.Time {
+	utcNorway := int((time.Hour).Seconds())
+	nor := time.FixedZone("Norway", utcNorway)
+	return time.Date(2018, 5, 23, 20, 40, 23, 0, nor)
+}
+
+// prepareRun creates the clouds, the job queue and the autoscaling run of a simulation request
+func (sim *Simulator) prepareRun(reqInput metapipe.ScalingRequestInput) (metapipeReturn) {
+	jobs, err := sim.loadJobs(reqInput)
+	if err != nil {
+		return metapipeReturn{err: err}
+	}
+	return sim.prepareRunWithJobs(reqInput, jobs)
+}
 
-	friendlyName := reqInput.Name
+// loadJobs converts the jobs of the request and estimates their execution times, and adds the jobs of the
+// workload and the trace of the request. The example jobs are used if the request has none of them
+func (sim *Simulator) loadJobs(reqInput metapipe.ScalingRequestInput) ([]autoscale.AlgorithmJob, error) {
+	if reqInput.Jobs == nil && reqInput.Workload == nil && reqInput.Trace == nil {
+		return metapipe.GetMetapipeJobs(defaultStartTime().Add(time.Duration(time.Minute * -5))), nil
+	}
+	var jobs []autoscale.AlgorithmJob
 	if reqInput.Jobs != nil {
 		algjobs, err := metapipe.ConvertMetapipeQueueToAlgInputJobs(reqInput.Jobs)
-		retVal.err = err
 		if err != nil {
-			return retVal
+			return nil, invalidRequest(err)
 		}
-		retVal.jobs, retVal.err = sim.Estimator.ProcessQueue(algjobs)
-		if retVal.err != nil {
-			return retVal
+		jobs, err = sim.Estimator.ProcessQueue(algjobs)
+		if err != nil {
+			return nil, err
 		}
-	} else {
-		retVal.jobs = jobs[:]
 	}
-
-	if friendlyName == "" {
-		friendlyName = ksuid.New().String()
+	start := defaultStartTime()
+	if reqInput.StartTime != "" {
+		var err error
+		start, err = metapipe.ParseMetapipeTimestamp(reqInput.StartTime)
+		if err != nil {
+			return nil, invalidRequest(err)
+		}
 	}
-	retVal.id, err = models.CreateAutoscalingRun(sim.DB, friendlyName, time.Now())
-	if retVal.err != nil {
-		return retVal
+	if reqInput.Workload != nil {
+		seed := reqInput.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		//The generated jobs have runtimes for every cloud, they are not estimated
+		generated, err := workload.Generate(*reqInput.Workload, start, seed)
+		if err != nil {
+			return nil, invalidRequest(err)
+		}
+		jobs = append(jobs, generated...)
 	}
-	setScalingIds(simC, retVal.id)
-	if reqInput.StartTime != "" {
-		retVal.timestamp, retVal.err = metapipe.ParseMetapipeTimestamp(reqInput.StartTime)
-	} else {
-		retVal.timestamp = defaultTime
+	if reqInput.Trace != nil {
+		//The trace gives the run time of the jobs, they are not estimated either
+		imported, err := swf.Read(strings.NewReader(reqInput.Trace.Data), reqInput.Trace.Config, start)
+		if err != nil {
+			return nil, invalidRequest(err)
+		}
+		jobs = append(jobs, imported...)
+	}
+	return jobs, nil
+}
+
+// prepareRunWithJobs is prepareRun with jobs that are already loaded, the run gets its own copy of the jobs
+func (sim *Simulator) prepareRunWithJobs(reqInput metapipe.ScalingRequestInput, jobs []autoscale.AlgorithmJob) (metapipeReturn) {
+	in := RunInput{
+		Name:       reqInput.Name,
+		Timestep:   reqInput.Timestep,
+		Iterations: reqInput.Iterations,
+		Mode:       reqInput.Mode,
+		Seed:       reqInput.Seed,
+		Jobs:       jobs,
+		Clusters:   reqInput.Clusters,
+		Algorithm:  sim.AlgorithmSpec,
+		Estimator:  sim.EstimatorSpec,
+		Noise:      reqInput.Noise,
+		Dispatcher: reqInput.Dispatcher,
+	}
+	if in.Clusters == nil {
+		in.Clusters = sim.SimClusters
 	}
 
-	retVal.input = algInput
-	retVal.err = nil
-	retVal.timestep = reqInput.Timestep
-	retVal.iterations = reqInput.Iterations
-	if retVal.timestep == 0 {
-		retVal.timestep = 30
+	alg := sim.Algorithm
+	if reqInput.Algorithm != nil {
+		var err error
+		in.Algorithm = *reqInput.Algorithm
+		alg, err = algorithm.FromSpec(in.Algorithm)
+		if err != nil {
+			return metapipeReturn{err: invalidRequest(err)}
+		}
 	}
-	if retVal.iterations == 0 {
-		retVal.iterations = 96
+
+	if reqInput.StartTime != "" {
+		var err error
+		in.StartTime, err = metapipe.ParseMetapipeTimestamp(reqInput.StartTime)
+		if err != nil {
+			return metapipeReturn{err: invalidRequest(err)}
+		}
 	}
-	return retVal
+	return sim.newRun(in, alg)
 }
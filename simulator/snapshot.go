@@ -0,0 +1,63 @@
+package simulator
+
+import (
+	"github.com/tteige/uit-go/autoscale"
+	"github.com/tteige/uit-go/models"
+	"time"
+)
+
+// recordSnapshots stores a snapshot of every cloud of the run with the jobs of the queue that are running on it
+// or queued for it
+func (sim *Simulator) recordSnapshots(run metapipeReturn, clouds autoscale.CloudCollection, queue []autoscale.AlgorithmJob, at time.Time) error {
+	for _, key := range clouds.Names() {
+		snapshot, err := clusterSnapshot(clouds[key], key, queue)
+		if err != nil {
+			return err
+		}
+		snapshot.RunName = run.id
+		snapshot.Timestamp = at
+		err = run.store.InsertClusterSnapshot(snapshot)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func clusterSnapshot(cloud autoscale.Cloud, key string, queue []autoscale.AlgorithmJob) (models.ClusterSnapshot, error) {
+	snapshot := models.ClusterSnapshot{
+		Cloud: key,
+		Limit: cloud.GetInstanceLimit(),
+		Types: make(map[string]int),
+	}
+	instances, err := cloud.GetInstances()
+	if err != nil {
+		return snapshot, err
+	}
+	for _, i := range instances {
+		switch i.State {
+		case autoscale.BOOTING:
+			snapshot.Booting++
+		case autoscale.IDLE:
+			snapshot.Idle++
+		case autoscale.BUSY:
+			snapshot.Busy++
+		case autoscale.DRAINING:
+			snapshot.Draining++
+		default:
+			continue
+		}
+		snapshot.Types[i.Type]++
+	}
+	for _, j := range queue {
+		if j.Tag != key || j.State == autoscale.FINISHED {
+			continue
+		}
+		if j.State == autoscale.RUNNING {
+			snapshot.RunningJobs++
+		} else {
+			snapshot.QueuedJobs++
+		}
+	}
+	return snapshot, nil
+}
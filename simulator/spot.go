@@ -0,0 +1,113 @@
+package simulator
+
+import (
+	"fmt"
+	"github.com/tteige/uit-go/autoscale"
+	"math"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// loadPrices returns a copy of the clusters where the price traces of the instance types are read into their
+// prices and the price schedules are validated, so the stored input of a run has the prices it was run with
+func loadPrices(clusters autoscale.ClusterCollection) (autoscale.ClusterCollection, error) {
+	clusters = clusters.Copy()
+	for _, cluster := range clusters {
+		for name, t := range cluster.Types {
+			if !autoscale.ValidMarket(t.Market) {
+				return nil, fmt.Errorf("unknown market %q of instance type %s of %s", t.Market, name, cluster.Name)
+			}
+			if t.PriceTrace != "" && len(t.Prices) == 0 {
+				f, err := os.Open(t.PriceTrace)
+				if err != nil {
+					return nil, err
+				}
+				t.Prices, err = autoscale.ReadPriceTrace(f)
+				f.Close()
+				if err != nil {
+					return nil, fmt.Errorf("%s: %s", t.PriceTrace, err)
+				}
+			}
+			autoscale.SortPrices(t.Prices)
+			if t.Schedule != nil {
+				err := t.Schedule.Validate()
+				if err != nil {
+					return nil, fmt.Errorf("price schedule of instance type %s of %s: %s", name, cluster.Name, err)
+				}
+			}
+			cluster.Types[name] = t
+		}
+	}
+	return clusters, nil
+}
+
+// armInterruption decides when a running instance of a spot or preemptible type is interrupted, if it does not
+// know already. The time is the earliest of the draw from the probability per hour, the first time the price goes
+// above the max price and the end of the lifetime of a preemptible instance
+func (c *SimCloud) armInterruption(instance autoscale.Instance, from time.Time) {
+	t := c.Cluster.Types[instance.Type]
+	if !t.Interruptible() {
+		return
+	}
+	if instance.State != autoscale.IDLE && instance.State != autoscale.BUSY && instance.State != autoscale.DRAINING {
+		return
+	}
+	if _, ok := c.interruptAt[instance.Id]; ok {
+		return
+	}
+	model := autoscale.InterruptionModel{}
+	if t.Interruptions != nil {
+		model = *t.Interruptions
+	}
+	var at time.Time
+	earliest := func(candidate time.Time) {
+		if at.IsZero() || candidate.Before(at) {
+			at = candidate
+		}
+	}
+	if model.PerHour > 0 {
+		//The interruptions are a Poisson process with the rate that gives PerHour within an hour
+		rate := -math.Log(1 - math.Min(model.PerHour, 1-1e-9))
+		rng := rand.New(rand.NewSource(deriveSeed(c.seed, instance.Id+"@interrupt")))
+		earliest(from.Add(time.Duration(rng.ExpFloat64() / rate * float64(time.Hour))))
+	}
+	if model.MaxPrice > 0 {
+		if t.PriceAt(from) > model.MaxPrice {
+			earliest(from)
+		}
+		for _, p := range t.Prices {
+			if p.Time.After(from) && p.Price > model.MaxPrice {
+				earliest(p.Time)
+				break
+			}
+		}
+	}
+	lifetime := time.Duration(model.Lifetime) * time.Second
+	if lifetime == 0 && t.Market == autoscale.PreemptibleMarket {
+		lifetime = autoscale.PreemptibleLifetime
+	}
+	if lifetime > 0 {
+		earliest(from.Add(lifetime))
+	}
+	if !at.IsZero() {
+		c.interruptAt[instance.Id] = at
+	}
+}
+
+// outbid reports if a spot request for the instance type is not fulfilled since the price is above the max price
+func (c *SimCloud) outbid(instanceType string, currentTime time.Time) bool {
+	t := c.Cluster.Types[instanceType]
+	return t.Interruptible() && t.Interruptions != nil && t.Interruptions.MaxPrice > 0 &&
+		t.PriceAt(currentTime) > t.Interruptions.MaxPrice
+}
+
+// failure returns the first of the crash and the interruption of the instance, with the event type it gives
+func (c *SimCloud) failure(id string) (time.Time, string, bool) {
+	crash, crashes := c.crashAt[id]
+	interrupt, interrupted := c.interruptAt[id]
+	if interrupted && (!crashes || interrupt.Before(crash)) {
+		return interrupt, "INTERRUPTED", true
+	}
+	return crash, "CRASHED", crashes
+}
@@ -0,0 +1,211 @@
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/tteige/uit-go/models"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The event names of the simulation event stream
+const (
+	simEventName      = "sim_event"
+	cloudEventName    = "cloud_event"
+	snapshotEventName = "snapshot"
+	doneEventName     = "done"
+)
+
+type streamEvent struct {
+	name string
+	time time.Time
+	data interface{}
+}
+
+// eventHub keeps the events of a running simulation for its subscribers. Publishing never waits for a subscriber,
+// every subscriber reads the events at its own pace and a subscriber that disconnects is simply not read for
+type eventHub struct {
+	mu      sync.Mutex
+	events  []streamEvent
+	changed chan struct{}
+	closed  bool
+}
+
+func (h *eventHub) publish(ev streamEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	h.events = append(h.events, ev)
+	h.notify()
+}
+
+// next returns the events after the first n, a channel that is closed when there are more events,
+// and true if the run is done and no more events will follow
+func (h *eventHub) next(n int) ([]streamEvent, <-chan struct{}, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.changed == nil {
+		h.changed = make(chan struct{})
+	}
+	return h.events[n:len(h.events):len(h.events)], h.changed, h.closed
+}
+
+func (h *eventHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	h.notify()
+}
+
+func (h *eventHub) notify() {
+	if h.changed != nil {
+		close(h.changed)
+		h.changed = nil
+	}
+}
+
+// streamingStore publishes the simulator events, cloud events and cluster snapshots of a run to its hub when they
+// are stored
+type streamingStore struct {
+	models.Store
+	hub *eventHub
+}
+
+func (s streamingStore) WriteSimEvent(event models.CloudEvent) error {
+	err := s.Store.WriteSimEvent(event)
+	if err != nil {
+		return err
+	}
+	s.hub.publish(streamEvent{name: cloudEventName, time: event.Created, data: event})
+	return nil
+}
+
+func (s streamingStore) InsertSimulatorEvent(event models.SimulatorEvent) error {
+	err := s.Store.InsertSimulatorEvent(event)
+	if err != nil {
+		return err
+	}
+	s.hub.publish(streamEvent{name: simEventName, time: event.AlgorithmTimestamp, data: event})
+	return nil
+}
+
+func (s streamingStore) InsertClusterSnapshot(snapshot models.ClusterSnapshot) error {
+	err := s.Store.InsertClusterSnapshot(snapshot)
+	if err != nil {
+		return err
+	}
+	s.hub.publish(streamEvent{name: snapshotEventName, time: snapshot.Timestamp, data: snapshot})
+	return nil
+}
+
+// simulationEventsHandle streams the simulator events, cloud events and cluster snapshots of a run as Server-Sent Events while it runs.
+// The events of a run that is already done are read from the store, the stream ends with a done event
+func (sim *Simulator) simulationEventsHandle(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	sim.Log.Printf("SimulationEventsRequest: /metapipe/simulation/%s/events", id)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	hub := sim.runs().events(id)
+	var stored []streamEvent
+	if hub == nil {
+		var err error
+		stored, err = sim.storedEvents(id)
+		if err != nil {
+			sim.Log.Print(err)
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	if hub != nil {
+		if !followEvents(w, r, flusher, hub) {
+			return
+		}
+	} else {
+		for _, ev := range stored {
+			err := writeServerEvent(w, ev.name, ev.data)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	status, err := sim.runStatus(id)
+	if err != nil {
+		return
+	}
+	writeServerEvent(w, doneEventName, status)
+	flusher.Flush()
+}
+
+// followEvents writes the events of the hub until the run is done, it returns false if the client went away first
+func followEvents(w http.ResponseWriter, r *http.Request, flusher http.Flusher, hub *eventHub) bool {
+	n := 0
+	for {
+		events, changed, done := hub.next(n)
+		for _, ev := range events {
+			err := writeServerEvent(w, ev.name, ev.data)
+			if err != nil {
+				return false
+			}
+		}
+		n += len(events)
+		flusher.Flush()
+		if done {
+			return true
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return false
+		}
+	}
+}
+
+// storedEvents reads the simulator events, cloud events and cluster snapshots of a run from the store in time order
+func (sim *Simulator) storedEvents(id string) ([]streamEvent, error) {
+	_, err := sim.Store.GetAutoscalingRun(id)
+	if err != nil {
+		return nil, fmt.Errorf("unknown simulation %s: %s", id, err)
+	}
+	out, err := sim.loadOutput(id)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]streamEvent, 0, len(out.SimEvents)+len(out.CloudEvents)+len(out.Snapshots))
+	for _, e := range out.SimEvents {
+		events = append(events, streamEvent{name: simEventName, time: e.AlgorithmTimestamp, data: e})
+	}
+	for _, e := range out.CloudEvents {
+		events = append(events, streamEvent{name: cloudEventName, time: e.Created, data: e})
+	}
+	for _, s := range out.Snapshots {
+		events = append(events, streamEvent{name: snapshotEventName, time: s.Timestamp, data: s})
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].time.Before(events[j].time)
+	})
+	return events, nil
+}
+
+func writeServerEvent(w http.ResponseWriter, name string, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, b)
+	return err
+}
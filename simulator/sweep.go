@@ -0,0 +1,440 @@
+package simulator
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/tteige/uit-go/algorithm"
+	"github.com/tteige/uit-go/autoscale"
+	"github.com/tteige/uit-go/metapipe"
+	"github.com/tteige/uit-go/models"
+	"io"
+	"math"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// The parameters a sweep can vary
+const (
+	SweepLimit           = "limit"
+	SweepPrice           = "price"
+	SweepTimestep        = "timestep"
+	SweepAlgorithmOption = "algorithm_option"
+)
+
+// SweepSpec runs the base request once for every combination of the values of the axes. Workers is the number
+// of runs of the sweep that run at the same time, the number of CPUs if zero
+type SweepSpec struct {
+	Name    string                       `json:"name"`
+	Workers int                          `json:"workers"`
+	Base    metapipe.ScalingRequestInput `json:"base"`
+	Axes    []SweepAxis                  `json:"axes"`
+}
+
+// SweepAxis is one parameter of a sweep and the values it takes. Limit and price axes change a cloud, price axes
+// change the "default" instance type if InstanceType is empty, and algorithm option axes set Option in the
+// options of the algorithm. Price axes only take types with a fixed price. A timestep axis keeps the simulated
+// period of the base request
+type SweepAxis struct {
+	Parameter    string            `json:"parameter"`
+	Cloud        string            `json:"cloud"`
+	InstanceType string            `json:"instance_type"`
+	Option       string            `json:"option"`
+	Values       []json.RawMessage `json:"values"`
+}
+
+// SweepRow is a combination of a sweep with the metrics of its run
+type SweepRow struct {
+	Run    string                  `json:"run"`
+	State  string                  `json:"state"`
+	Values map[string]string       `json:"values"`
+	Total  CloudMetrics            `json:"total"`
+	Clouds map[string]CloudMetrics `json:"clouds"`
+	Error  string                  `json:"error,omitempty"`
+}
+
+// SweepSummary is the state of a sweep with a row for every combination, the metrics of a row are set when
+// its run is finished
+type SweepSummary struct {
+	Name  string     `json:"name"`
+	State string     `json:"state"`
+	Axes  []string   `json:"axes"`
+	Rows  []SweepRow `json:"rows"`
+	Error string     `json:"error,omitempty"`
+}
+
+type sweep struct {
+	batch
+	axes []string
+}
+
+// sweepLabels is stored with every run of a sweep
+type sweepLabels struct {
+	Axes   []string          `json:"axes"`
+	Values map[string]string `json:"values"`
+}
+
+// Label names the axis in the summary and the CSV header
+func (a SweepAxis) Label() string {
+	switch a.Parameter {
+	case SweepLimit:
+		return "limit " + a.Cloud
+	case SweepPrice:
+		return "price " + a.Cloud + "/" + a.instanceType()
+	case SweepAlgorithmOption:
+		return "option " + a.Option
+	}
+	return a.Parameter
+}
+
+func (a SweepAxis) instanceType() string {
+	if a.InstanceType == "" {
+		return "default"
+	}
+	return a.InstanceType
+}
+
+func (a SweepAxis) validate(clusters autoscale.ClusterCollection) error {
+	if len(a.Values) == 0 {
+		return fmt.Errorf("the %s axis has no values", a.Label())
+	}
+	switch a.Parameter {
+	case SweepLimit, SweepPrice:
+		cluster, ok := clusters[a.Cloud]
+		if !ok {
+			return fmt.Errorf("the %s axis has an unknown cloud %q", a.Parameter, a.Cloud)
+		}
+		if a.Parameter != SweepPrice {
+			break
+		}
+		t, ok := cluster.Types[a.instanceType()]
+		if !ok {
+			return fmt.Errorf("the %s axis has an unknown instance type %q", a.Parameter, a.instanceType())
+		}
+		//The axis sets PriceIncrement, which a type with a price history or schedule only uses before it starts
+		if len(t.Prices) > 0 || t.PriceTrace != "" || t.Schedule != nil {
+			return fmt.Errorf("the %s axis can not change instance type %q, its price changes over time", a.Parameter, a.instanceType())
+		}
+	case SweepTimestep:
+	case SweepAlgorithmOption:
+		if a.Option == "" {
+			return fmt.Errorf("the algorithm option axis needs an option")
+		}
+	default:
+		return fmt.Errorf("unknown sweep parameter %q", a.Parameter)
+	}
+	return nil
+}
+
+// apply sets the value of the axis in the request, the clusters of the request must be a copy
+func (a SweepAxis) apply(input *metapipe.ScalingRequestInput, value json.RawMessage) error {
+	switch a.Parameter {
+	case SweepLimit:
+		var limit int
+		if err := json.Unmarshal(value, &limit); err != nil {
+			return fmt.Errorf("%s: %s", a.Label(), err)
+		}
+		cluster := input.Clusters[a.Cloud]
+		cluster.Limit = limit
+		input.Clusters[a.Cloud] = cluster
+	case SweepPrice:
+		var price float64
+		if err := json.Unmarshal(value, &price); err != nil {
+			return fmt.Errorf("%s: %s", a.Label(), err)
+		}
+		t := input.Clusters[a.Cloud].Types[a.instanceType()]
+		t.PriceIncrement = price
+		input.Clusters[a.Cloud].Types[a.instanceType()] = t
+	case SweepTimestep:
+		var timestep int
+		if err := json.Unmarshal(value, &timestep); err != nil || timestep <= 0 {
+			return fmt.Errorf("%s: invalid timestep %s", a.Label(), value)
+		}
+		//The same period is simulated with the new timestep
+		period := input.Timestep * input.Iterations
+		input.Timestep = timestep
+		input.Iterations = int(math.Ceil(float64(period) / float64(timestep)))
+	case SweepAlgorithmOption:
+		options := make(map[string]json.RawMessage)
+		if len(nullOptions(input.Algorithm.Options)) > 0 {
+			if err := json.Unmarshal(input.Algorithm.Options, &options); err != nil {
+				return fmt.Errorf("%s: %s", a.Label(), err)
+			}
+		}
+		options[a.Option] = value
+		b, err := json.Marshal(options)
+		if err != nil {
+			return err
+		}
+		spec := *input.Algorithm
+		spec.Options = b
+		input.Algorithm = &spec
+	}
+	return nil
+}
+
+// combinations expands the axes to their cartesian product, the last axis changes fastest
+func combinations(axes []SweepAxis) [][]int {
+	combos := [][]int{{}}
+	for _, axis := range axes {
+		var next [][]int
+		for _, combo := range combos {
+			for i := range axis.Values {
+				next = append(next, append(append([]int(nil), combo...), i))
+			}
+		}
+		combos = next
+	}
+	return combos
+}
+
+// Sweep runs every combination of the sweep and waits for the summary
+func (sim *Simulator) Sweep(spec SweepSpec) (SweepSummary, error) {
+	s, err := sim.startSweep(spec)
+	if err != nil {
+		return SweepSummary{}, err
+	}
+	runErr := s.wait()
+	summary, err := sim.sweepSummary(s.name)
+	if err != nil {
+		return summary, err
+	}
+	return summary, runErr
+}
+
+// startSweep creates a run for every combination of the sweep and runs them on a pool of workers. The jobs are
+// loaded once and every run has the seed of the base request, so the axes are the only difference between the runs
+func (sim *Simulator) startSweep(spec SweepSpec) (*sweep, error) {
+	base := sim.batchInput(spec.Base)
+	//Algorithm option axes change the options of the default algorithm
+	if base.Algorithm == nil {
+		alg := sim.AlgorithmSpec
+		base.Algorithm = &alg
+	}
+	for _, axis := range spec.Axes {
+		err := axis.validate(base.Clusters)
+		if err != nil {
+			return nil, invalidRequest(err)
+		}
+	}
+	s := &sweep{batch: newBatch(spec.Name)}
+	for _, axis := range spec.Axes {
+		s.axes = append(s.axes, axis.Label())
+	}
+
+	jobs, err := sim.loadJobs(base)
+	if err != nil {
+		return nil, err
+	}
+	var runs []metapipeReturn
+	for i, combo := range combinations(spec.Axes) {
+		runInput := base
+		runInput.Name = fmt.Sprintf("%s-%d", s.name, i+1)
+		runInput.Clusters = base.Clusters.Copy()
+		labels := sweepLabels{Axes: s.axes, Values: make(map[string]string)}
+		for a, axis := range spec.Axes {
+			value := axis.Values[combo[a]]
+			err = axis.apply(&runInput, value)
+			if err != nil {
+				return nil, invalidRequest(err)
+			}
+			labels.Values[axis.Label()] = string(value)
+		}
+		//Check the algorithm options before anything is stored
+		_, err = algorithm.FromSpec(*runInput.Algorithm)
+		if err != nil {
+			return nil, invalidRequest(err)
+		}
+		run := sim.prepareRunWithJobs(runInput, jobs)
+		if run.err != nil {
+			return nil, run.err
+		}
+		b, err := json.Marshal(&labels)
+		if err != nil {
+			return nil, err
+		}
+		err = sim.Store.InsertRunGroupMember(models.RunGroupMember{Group: s.name, RunName: run.id, Labels: b})
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	workers := spec.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	pending := make(chan metapipeReturn, len(runs))
+	for _, run := range runs {
+		pending <- run
+	}
+	close(pending)
+	sim.runs().addSweep(s)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for w := 0; w < workers && w < len(runs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for run := range pending {
+				res := <-sim.runs().start(run)
+				mu.Lock()
+				if res.err != nil && s.err == nil {
+					s.err = res.err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(s.done)
+	}()
+	return s, nil
+}
+
+// sweepSummary reads the runs of a sweep from the store, so the summary of a sweep is also available after
+// the simulator is restarted
+func (sim *Simulator) sweepSummary(name string) (SweepSummary, error) {
+	summary := SweepSummary{Name: name, State: RunFinished}
+	members, err := sim.Store.GetRunGroup(name)
+	if err != nil {
+		return summary, err
+	}
+	if len(members) == 0 {
+		return summary, fmt.Errorf("unknown sweep %s", name)
+	}
+	s, running := sim.runs().sweep(name)
+	if running {
+		select {
+		case <-s.done:
+		default:
+			summary.State = RunRunning
+		}
+	}
+	for _, member := range members {
+		var labels sweepLabels
+		err = json.Unmarshal(member.Labels, &labels)
+		if err != nil {
+			return summary, err
+		}
+		summary.Axes = labels.Axes
+		row := SweepRow{Run: member.RunName, State: RunFinished, Values: labels.Values}
+		if status, ok := sim.runs().status(member.RunName); ok {
+			row.State = status.State
+			row.Error = status.Error
+		} else if summary.State == RunRunning {
+			//The run waits for a worker of the sweep
+			row.State = RunQueued
+		} else if run, err := sim.Store.GetAutoscalingRun(member.RunName); err != nil || !run.Finished.Valid {
+			//The simulator was restarted before the run finished
+			row.State = RunFailed
+		}
+		if row.State == RunFinished {
+			row.Clouds, row.Total, err = sim.runMetrics(member.RunName)
+			if err != nil {
+				return summary, err
+			}
+		}
+		if row.State == RunFailed && summary.State == RunFinished {
+			summary.State = RunFailed
+			summary.Error = row.Error
+		}
+		summary.Rows = append(summary.Rows, row)
+	}
+	return summary, nil
+}
+
+// WriteCSV writes the summary with a row for every combination, the values of the axes come first
+func (s SweepSummary) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	header := append([]string{"run", "state"}, s.Axes...)
+	header = append(header, "billed_cost", "idle_cost", "makespan_ms", "mean_wait_ms", "p95_wait_ms", "finished", "unfinished",
+		"deadline_misses", "instance_hours", "idle_instance_hours")
+	err := cw.Write(header)
+	if err != nil {
+		return err
+	}
+	for _, row := range s.Rows {
+		record := []string{row.Run, row.State}
+		for _, axis := range s.Axes {
+			record = append(record, row.Values[axis])
+		}
+		m := row.Total
+		record = append(record,
+			strconv.FormatFloat(m.BilledCost, 'f', -1, 64),
+			strconv.FormatFloat(m.IdleCost, 'f', -1, 64),
+			strconv.FormatInt(m.Makespan, 10),
+			strconv.FormatFloat(m.MeanWait, 'f', -1, 64),
+			strconv.FormatFloat(m.P95Wait, 'f', -1, 64),
+			strconv.Itoa(m.Finished),
+			strconv.Itoa(m.Unfinished),
+			strconv.Itoa(m.DeadlineMisses),
+			strconv.FormatFloat(m.InstanceHours, 'f', -1, 64),
+			strconv.FormatFloat(m.IdleInstanceHours, 'f', -1, 64))
+		err = cw.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// sweepHandle starts a sweep, its summary is polled at the returned location
+func (sim *Simulator) sweepHandle(w http.ResponseWriter, r *http.Request) {
+	sim.Log.Print("SweepRequest: /metapipe/sweep/")
+
+	var spec SweepSpec
+	err := json.NewDecoder(r.Body).Decode(&spec)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s, err := sim.startSweep(spec)
+	if err != nil {
+		sim.Log.Print(err)
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	summary, err := sim.sweepSummary(s.name)
+	if err != nil {
+		sim.Log.Print(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sim.acceptBatch(w, "sweep", "/metapipe/sweep/", &s.batch, &summary)
+}
+
+func (sim *Simulator) sweepSummaryHandle(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	sim.Log.Printf("SweepSummaryRequest: /metapipe/sweep/%s", name)
+
+	summary, err := sim.sweepSummary(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	enc := json.NewEncoder(w)
+	enc.Encode(&summary)
+}
+
+func (sim *Simulator) sweepCSVHandle(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	sim.Log.Printf("SweepCSVRequest: /metapipe/sweep/%s/csv", name)
+
+	summary, err := sim.sweepSummary(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+name+".csv\"")
+	err = summary.WriteCSV(w)
+	if err != nil {
+		sim.Log.Print(err)
+	}
+}
@@ -0,0 +1,245 @@
+package swf
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/tteige/uit-go/autoscale"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The fields of a record in the Standard Workload Format, see http://www.cs.huji.ac.il/labs/parallel/workload/swf.html
+const (
+	fieldJob = iota
+	fieldSubmit
+	fieldWait
+	fieldRunTime
+	fieldAllocatedProcessors
+	fieldAverageCPUTime
+	fieldUsedMemory
+	fieldRequestedProcessors
+	fieldRequestedTime
+	fieldRequestedMemory
+	fieldStatus
+	fieldUser
+	fieldGroup
+	fieldExecutable
+	fieldQueue
+	fieldPartition
+	fieldPrecedingJob
+	fieldThinkTime
+	numFields
+)
+
+const statusCompleted = 1
+
+// Config maps the records of a trace to jobs
+type Config struct {
+	// Start is the time of submit time 0, the UnixStartTime of the trace header is used if it is zero
+	Start time.Time `json:"start"`
+	// Queues and Partitions map the queue and partition numbers of the records to tags, the queue is used
+	// if both match. Records that match neither get DefaultTag
+	Queues     map[int]string `json:"queues"`
+	Partitions map[int]string `json:"partitions"`
+	DefaultTag string         `json:"default_tag"`
+	// Clouds are given the run time of the record as execution time, in addition to the tag of the job
+	Clouds []string `json:"clouds"`
+}
+
+// Trace is a trace in the Standard Workload Format with the config to import it
+type Trace struct {
+	Config
+	// Data is the content of the SWF file
+	Data string `json:"data"`
+}
+
+// Read converts the records of an SWF trace to jobs. The submit time gives the created time of the job,
+// the run time its execution time and the requested processors and memory its resources. Records without
+// a run time are skipped. If neither the config nor the trace gives a start time, start is used
+func Read(r io.Reader, conf Config, start time.Time) ([]autoscale.AlgorithmJob, error) {
+	headerStart := time.Time{}
+	var jobs []autoscale.AlgorithmJob
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		if strings.HasPrefix(text, ";") {
+			key, value := headerField(text)
+			if key == "UnixStartTime" {
+				sec, err := strconv.ParseInt(value, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid UnixStartTime %q", line, value)
+				}
+				headerStart = time.Unix(sec, 0).UTC()
+			}
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) < numFields {
+			return nil, fmt.Errorf("line %d: a record has %d fields, got %d", line, numFields, len(fields))
+		}
+		var values [numFields]float64
+		for i := range values {
+			v, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: field %d is not a number: %q", line, i+1, fields[i])
+			}
+			values[i] = v
+		}
+		if values[fieldRunTime] < 0 {
+			continue
+		}
+
+		job := autoscale.AlgorithmJob{
+			Id:            "swf-" + fields[fieldJob],
+			State:         autoscale.QUEUED,
+			Tag:           conf.tag(int(values[fieldQueue]), int(values[fieldPartition])),
+			ExecutionTime: make(map[string]int64),
+			Processors:    int(known(values[fieldRequestedProcessors], values[fieldAllocatedProcessors])),
+			Memory:        int64(known(values[fieldRequestedMemory], values[fieldUsedMemory])),
+		}
+		job.Created = job.Created.Add(time.Duration(values[fieldSubmit] * float64(time.Second)))
+		runtime := int64(values[fieldRunTime] * 1000)
+		if job.Tag != "" {
+			job.ExecutionTime[job.Tag] = runtime
+		}
+		for _, cloud := range conf.Clouds {
+			job.ExecutionTime[cloud] = runtime
+		}
+		jobs = append(jobs, job)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	//The submit times are relative until the start of the trace is known
+	if !conf.Start.IsZero() {
+		start = conf.Start
+	} else if !headerStart.IsZero() {
+		start = headerStart
+	}
+	for i := range jobs {
+		jobs[i].Created = start.Add(jobs[i].Created.Sub(time.Time{}))
+	}
+	return jobs, nil
+}
+
+// Write writes the finished jobs as an SWF trace in the order they were submitted. The wait time is the time
+// from the job was created until it started, each tag is a partition and the partitions are listed in the header
+func Write(w io.Writer, jobs []autoscale.AlgorithmJob, note string) error {
+	var finished []autoscale.AlgorithmJob
+	tags := make(map[string]int)
+	for _, job := range jobs {
+		if job.State != autoscale.FINISHED {
+			continue
+		}
+		finished = append(finished, job)
+		tags[job.Tag] = 0
+	}
+	sort.SliceStable(finished, func(i, j int) bool {
+		return finished[i].Created.Before(finished[j].Created)
+	})
+	partitions := make([]string, 0, len(tags))
+	for tag := range tags {
+		partitions = append(partitions, tag)
+	}
+	sort.Strings(partitions)
+	for i, tag := range partitions {
+		tags[tag] = i + 1
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "; Version: 2.2")
+	if note != "" {
+		fmt.Fprintf(bw, "; Note: %s\n", note)
+	}
+	var start time.Time
+	if len(finished) > 0 {
+		start = finished[0].Created.Truncate(time.Second)
+		fmt.Fprintf(bw, "; UnixStartTime: %d\n", start.Unix())
+	}
+	fmt.Fprintf(bw, "; MaxJobs: %d\n", len(finished))
+	fmt.Fprintf(bw, "; MaxRecords: %d\n", len(finished))
+	fmt.Fprintf(bw, "; MaxPartitions: %d\n", len(partitions))
+	for i, tag := range partitions {
+		fmt.Fprintf(bw, "; Partition: %d %s\n", i+1, tag)
+	}
+
+	for i, job := range finished {
+		processors := int64(job.Processors)
+		if processors <= 0 {
+			processors = -1
+		}
+		memory := job.Memory
+		if memory <= 0 {
+			memory = -1
+		}
+		values := [numFields]int64{
+			fieldJob:                 int64(i + 1),
+			fieldSubmit:              int64(job.Created.Sub(start) / time.Second),
+			fieldWait:                int64(job.Started.Sub(job.Created) / time.Second),
+			fieldRunTime:             job.ExecutionTime[job.Tag] / 1000,
+			fieldAllocatedProcessors: processors,
+			fieldAverageCPUTime:      -1,
+			fieldUsedMemory:          -1,
+			fieldRequestedProcessors: processors,
+			fieldRequestedTime:       -1,
+			fieldRequestedMemory:     memory,
+			fieldStatus:              statusCompleted,
+			fieldUser:                -1,
+			fieldGroup:               -1,
+			fieldExecutable:          -1,
+			fieldQueue:               -1,
+			fieldPartition:           int64(tags[job.Tag]),
+			fieldPrecedingJob:        -1,
+			fieldThinkTime:           -1,
+		}
+		for f, v := range values {
+			if f > 0 {
+				bw.WriteByte(' ')
+			}
+			bw.WriteString(strconv.FormatInt(v, 10))
+		}
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+func (c Config) tag(queue int, partition int) string {
+	if tag, ok := c.Queues[queue]; ok {
+		return tag
+	}
+	if tag, ok := c.Partitions[partition]; ok {
+		return tag
+	}
+	return c.DefaultTag
+}
+
+// headerField splits a header comment like "; UnixStartTime: 1234" into its key and value
+func headerField(line string) (string, string) {
+	line = strings.TrimSpace(strings.TrimPrefix(line, ";"))
+	i := strings.Index(line, ":")
+	if i < 0 {
+		return "", ""
+	}
+	return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+}
+
+// known returns the requested value, or the used value if the request is missing. Missing values are -1 in SWF
+func known(requested float64, used float64) float64 {
+	if requested > 0 {
+		return requested
+	}
+	if used > 0 {
+		return used
+	}
+	return 0
+}
@@ -0,0 +1,108 @@
+package swf
+
+import (
+	"bytes"
+	"github.com/tteige/uit-go/autoscale"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoundTrip(t *testing.T) {
+	start := time.Date(2017, 11, 24, 16, 0, 0, 0, time.UTC)
+	jobs := []autoscale.AlgorithmJob{
+		{
+			Id:            "b",
+			State:         autoscale.FINISHED,
+			Tag:           "csc",
+			Created:       start.Add(90 * time.Second),
+			Started:       start.Add(10 * time.Minute),
+			ExecutionTime: map[string]int64{"csc": 7200000},
+		},
+		{
+			Id:            "a",
+			State:         autoscale.FINISHED,
+			Tag:           "aws",
+			Created:       start,
+			Started:       start.Add(time.Minute),
+			ExecutionTime: map[string]int64{"aws": 3600000, "csc": 1000},
+			Processors:    16,
+			Memory:        2048,
+		},
+		{
+			Id:            "c",
+			State:         autoscale.QUEUED,
+			Tag:           "aws",
+			Created:       start.Add(time.Hour),
+			ExecutionTime: map[string]int64{"aws": 60000},
+		},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, jobs, "round trip"); err != nil {
+		t.Fatal(err)
+	}
+	read, err := Read(&buf, Config{Partitions: map[int]string{1: "aws", 2: "csc"}}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Only the finished jobs are written, in the order they were submitted
+	want := []autoscale.AlgorithmJob{jobs[1], jobs[0]}
+	if len(read) != len(want) {
+		t.Fatalf("read %d jobs, want %d", len(read), len(want))
+	}
+	for i, w := range want {
+		got := read[i]
+		if got.State != autoscale.QUEUED || got.Tag != w.Tag || !got.Created.Equal(w.Created) ||
+			got.ExecutionTime[w.Tag] != w.ExecutionTime[w.Tag] || got.Processors != w.Processors || got.Memory != w.Memory {
+			t.Errorf("job %d is %+v, want %+v", i, got, w)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	trace := `; UnixStartTime: 1511539088
+; Note: the second record has no run time
+1 0 10 3600 16 -1 -1 -1 7200 -1 1 3 1 -1 2 1 -1 -1
+2 30 10 -1 16 -1 -1 16 7200 -1 0 3 1 -1 2 1 -1 -1
+3 60 10 120.5 -1 -1 512 4 7200 -1 1 3 1 -1 9 1 -1 -1
+4 90 10 10 1 -1 -1 1 7200 -1 1 3 1 -1 7 7 -1 -1
+`
+	conf := Config{
+		Queues:     map[int]string{2: "metapipe"},
+		Partitions: map[int]string{1: "aws"},
+		DefaultTag: "csc",
+		Clouds:     []string{"stallo"},
+	}
+	jobs, err := Read(strings.NewReader(trace), conf, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(1511539088, 0).UTC()
+	want := []autoscale.AlgorithmJob{
+		{Id: "swf-1", Tag: "metapipe", Created: start, Processors: 16, ExecutionTime: map[string]int64{"metapipe": 3600000, "stallo": 3600000}},
+		{Id: "swf-3", Tag: "aws", Created: start.Add(time.Minute), Processors: 4, Memory: 512, ExecutionTime: map[string]int64{"aws": 120500, "stallo": 120500}},
+		{Id: "swf-4", Tag: "csc", Created: start.Add(90 * time.Second), Processors: 1, ExecutionTime: map[string]int64{"csc": 10000, "stallo": 10000}},
+	}
+	if len(jobs) != len(want) {
+		t.Fatalf("read %d jobs, want %d", len(jobs), len(want))
+	}
+	for i, w := range want {
+		got := jobs[i]
+		same := got.Id == w.Id && got.Tag == w.Tag && got.Created.Equal(w.Created) && got.Processors == w.Processors &&
+			got.Memory == w.Memory && len(got.ExecutionTime) == len(w.ExecutionTime)
+		for cloud, ms := range w.ExecutionTime {
+			same = same && got.ExecutionTime[cloud] == ms
+		}
+		if !same {
+			t.Errorf("job %d is %+v, want %+v", i, got, w)
+		}
+	}
+
+	if _, err := Read(strings.NewReader("1 0 10 3600\n"), conf, start); err == nil {
+		t.Error("a short record was accepted")
+	}
+	if _, err := Read(strings.NewReader(strings.Replace(trace, "3600", "long", 1)), conf, start); err == nil {
+		t.Error("a record with a field that is not a number was accepted")
+	}
+}
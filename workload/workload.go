@@ -0,0 +1,293 @@
+package workload
+
+import (
+	"fmt"
+	"github.com/tteige/uit-go/autoscale"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Arrival patterns
+const (
+	Poisson = "poisson"
+	Diurnal = "diurnal"
+	Weekly  = "weekly"
+)
+
+// Runtime distributions
+const (
+	Exponential = "exponential"
+	Lognormal   = "lognormal"
+	Pareto      = "pareto"
+	Weibull     = "weibull"
+)
+
+// Spec describes a synthetic workload. The same spec and seed always generate the same jobs
+type Spec struct {
+	// Seed of the generator, the seed of the simulation is used if zero
+	Seed int64 `json:"seed"`
+	// Start of the arrivals, the start time of the simulation if zero
+	Start time.Time `json:"start"`
+	// Duration is the length of the arrival period in hours, 24 if zero
+	Duration float64 `json:"duration"`
+	// MaxJobs stops the generator after this many jobs, there is no limit if zero
+	MaxJobs int     `json:"max_jobs"`
+	Arrival Arrival `json:"arrival"`
+	// Runtime is the runtime distribution of the jobs on each cloud
+	Runtime map[string]Runtime `json:"runtime"`
+	// Tags are the relative weights of the tags given to the jobs, the empty tag leaves the choice of cloud to
+	// the algorithm. All jobs are untagged if there are no tags
+	Tags map[string]float64 `json:"tags"`
+	// Priorities are the priority classes of the jobs, all jobs have priority 0 and no deadline if there are none
+	Priorities []PriorityClass `json:"priorities"`
+}
+
+// Arrival is the arrival process of the jobs. Poisson arrivals have a constant rate, diurnal arrivals follow a
+// daily cosine with its maximum at PeakHour, and weekly arrivals also scale the rate by the day of the week
+type Arrival struct {
+	Pattern string `json:"pattern"`
+	// Rate is the mean number of arrivals per hour
+	Rate float64 `json:"rate"`
+	// Amplitude is the relative daily variation of the rate, between 0 and 1
+	Amplitude float64 `json:"amplitude"`
+	// PeakHour is the hour of the day with the highest rate
+	PeakHour float64 `json:"peak_hour"`
+	// Weekdays scales the rate of each day of the week, starting with Sunday.
+	// The weekends have half the rate if it is empty
+	Weekdays []float64 `json:"weekdays"`
+}
+
+// Runtime is a runtime distribution in seconds. Scale and Shape are the median and sigma of the lognormal
+// distribution, the minimum and alpha of the Pareto distribution, the lambda and k of the Weibull distribution
+// and the mean of the exponential distribution. Runtimes longer than Max are cut to Max if it is set
+type Runtime struct {
+	Distribution string  `json:"distribution"`
+	Scale        float64 `json:"scale"`
+	Shape        float64 `json:"shape"`
+	Max          float64 `json:"max"`
+}
+
+// PriorityClass is a share of the jobs with the same priority. Jobs of a class with a slack get a deadline of
+// Slack times their shortest runtime after they arrive
+type PriorityClass struct {
+	Priority int     `json:"priority"`
+	Weight   float64 `json:"weight"`
+	Slack    float64 `json:"slack"`
+}
+
+var defaultWeekdays = []float64{0.5, 1, 1, 1, 1, 1, 0.5}
+
+// Validate checks the arrival pattern, the runtime distributions and the weights of the spec
+func (s Spec) Validate() error {
+	switch s.Arrival.Pattern {
+	case Poisson, Diurnal, Weekly:
+	default:
+		return fmt.Errorf("unknown arrival pattern %q", s.Arrival.Pattern)
+	}
+	if s.Arrival.Rate <= 0 {
+		return fmt.Errorf("the arrival rate must be positive")
+	}
+	if s.Arrival.Amplitude < 0 || s.Arrival.Amplitude > 1 {
+		return fmt.Errorf("the arrival amplitude must be between 0 and 1")
+	}
+	if len(s.Arrival.Weekdays) != 0 && len(s.Arrival.Weekdays) != 7 {
+		return fmt.Errorf("weekdays needs a factor for each of the 7 days")
+	}
+	largest := 0.0
+	for _, w := range s.Arrival.Weekdays {
+		if w < 0 {
+			return fmt.Errorf("negative weekday factor %v", w)
+		}
+		largest = math.Max(largest, w)
+	}
+	//The arrivals are drawn at the largest rate and thinned, they never end without a positive rate
+	if len(s.Arrival.Weekdays) != 0 && largest <= 0 {
+		return fmt.Errorf("at least one weekday factor must be positive")
+	}
+	if len(s.Runtime) == 0 {
+		return fmt.Errorf("the workload has no runtime distributions")
+	}
+	for cloud, r := range s.Runtime {
+		switch r.Distribution {
+		case Exponential, Lognormal, Pareto, Weibull:
+		default:
+			return fmt.Errorf("unknown runtime distribution %q for %s", r.Distribution, cloud)
+		}
+		if r.Scale <= 0 || (r.Distribution != Exponential && r.Shape <= 0) {
+			return fmt.Errorf("the runtime distribution of %s needs a positive scale and shape", cloud)
+		}
+	}
+	for tag, w := range s.Tags {
+		if w < 0 {
+			return fmt.Errorf("negative weight of tag %q", tag)
+		}
+		//A job runs on the cloud of its tag, so the tag needs the runtime on that cloud
+		if _, ok := s.Runtime[tag]; tag != "" && !ok {
+			return fmt.Errorf("tag %q has no runtime distribution", tag)
+		}
+	}
+	for _, p := range s.Priorities {
+		if p.Weight < 0 || p.Slack < 0 {
+			return fmt.Errorf("negative weight or slack of priority class %d", p.Priority)
+		}
+	}
+	return nil
+}
+
+// Generate creates the jobs of the workload. start is used if the spec has no start and seed if it has no seed
+func Generate(spec Spec, start time.Time, seed int64) ([]autoscale.AlgorithmJob, error) {
+	err := spec.Validate()
+	if err != nil {
+		return nil, err
+	}
+	if !spec.Start.IsZero() {
+		start = spec.Start
+	}
+	if spec.Seed != 0 {
+		seed = spec.Seed
+	}
+	duration := spec.Duration
+	if duration == 0 {
+		duration = 24
+	}
+	end := start.Add(time.Duration(duration * float64(time.Hour)))
+
+	rng := rand.New(rand.NewSource(seed))
+	tags := sortedTags(spec.Tags)
+	clouds := make([]string, 0, len(spec.Runtime))
+	for cloud := range spec.Runtime {
+		clouds = append(clouds, cloud)
+	}
+	sort.Strings(clouds)
+
+	//The arrivals of the non-homogeneous process are drawn at the highest rate and thinned to the rate at each time
+	maxRate := spec.Arrival.maxRate()
+	var jobs []autoscale.AlgorithmJob
+	t := start
+	for spec.MaxJobs == 0 || len(jobs) < spec.MaxJobs {
+		t = t.Add(time.Duration(rng.ExpFloat64() / maxRate * float64(time.Hour)))
+		if !t.Before(end) {
+			break
+		}
+		if rng.Float64()*maxRate > spec.Arrival.rate(t) {
+			continue
+		}
+
+		job := autoscale.AlgorithmJob{
+			Id:            fmt.Sprintf("wl-%06d", len(jobs)+1),
+			State:         autoscale.QUEUED,
+			Created:       t,
+			ExecutionTime: make(map[string]int64, len(clouds)),
+		}
+		//A single quantile is used on every cloud, so a long job is long everywhere
+		u := rng.Float64()
+		var shortest int64
+		for _, cloud := range clouds {
+			ms := int64(spec.Runtime[cloud].quantile(u) * 1000)
+			job.ExecutionTime[cloud] = ms
+			if shortest == 0 || ms < shortest {
+				shortest = ms
+			}
+		}
+		if len(tags) > 0 {
+			job.Tag = tags[pick(rng, len(tags), func(i int) float64 { return spec.Tags[tags[i]] })]
+			if ms, ok := job.ExecutionTime[job.Tag]; ok {
+				shortest = ms
+			}
+		}
+		if len(spec.Priorities) > 0 {
+			class := spec.Priorities[pick(rng, len(spec.Priorities), func(i int) float64 { return spec.Priorities[i].Weight })]
+			job.Priority = class.Priority
+			if class.Slack > 0 {
+				job.Deadline = t.Add(time.Duration(class.Slack * float64(shortest) * float64(time.Millisecond)))
+			}
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func (a Arrival) weekday(t time.Time) float64 {
+	if a.Pattern != Weekly {
+		return 1
+	}
+	weekdays := a.Weekdays
+	if len(weekdays) == 0 {
+		weekdays = defaultWeekdays
+	}
+	return weekdays[t.Weekday()]
+}
+
+// rate is the arrival rate per hour at t
+func (a Arrival) rate(t time.Time) float64 {
+	if a.Pattern == Poisson {
+		return a.Rate
+	}
+	hour := float64(t.Hour()) + float64(t.Minute())/60 + float64(t.Second())/3600
+	daily := 1 + a.Amplitude*math.Cos(2*math.Pi*(hour-a.PeakHour)/24)
+	return a.Rate * daily * a.weekday(t)
+}
+
+func (a Arrival) maxRate() float64 {
+	if a.Pattern == Poisson {
+		return a.Rate
+	}
+	weekday := 1.0
+	if a.Pattern == Weekly {
+		weekday = 0
+		weekdays := a.Weekdays
+		if len(weekdays) == 0 {
+			weekdays = defaultWeekdays
+		}
+		for _, w := range weekdays {
+			weekday = math.Max(weekday, w)
+		}
+	}
+	return a.Rate * (1 + a.Amplitude) * weekday
+}
+
+// quantile is the runtime in seconds with the cumulative probability u
+func (r Runtime) quantile(u float64) float64 {
+	var x float64
+	switch r.Distribution {
+	case Exponential:
+		x = -r.Scale * math.Log(1-u)
+	case Lognormal:
+		x = r.Scale * math.Exp(r.Shape*math.Sqrt2*math.Erfinv(2*u-1))
+	case Pareto:
+		x = r.Scale / math.Pow(1-u, 1/r.Shape)
+	case Weibull:
+		x = r.Scale * math.Pow(-math.Log(1-u), 1/r.Shape)
+	}
+	if r.Max > 0 && x > r.Max {
+		x = r.Max
+	}
+	return x
+}
+
+func sortedTags(weights map[string]float64) []string {
+	tags := make([]string, 0, len(weights))
+	for tag := range weights {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// pick draws an index between 0 and n with the given weights, the first index if all weights are zero
+func pick(rng *rand.Rand, n int, weight func(i int) float64) int {
+	total := 0.0
+	for i := 0; i < n; i++ {
+		total += weight(i)
+	}
+	x := rng.Float64() * total
+	for i := 0; i < n; i++ {
+		x -= weight(i)
+		if x < 0 {
+			return i
+		}
+	}
+	return 0
+}
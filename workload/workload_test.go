@@ -0,0 +1,147 @@
+package workload
+
+import (
+	"github.com/tteige/uit-go/autoscale"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testSpec() Spec {
+	return Spec{
+		Duration: 72,
+		Arrival:  Arrival{Pattern: Weekly, Rate: 4, Amplitude: 0.8, PeakHour: 14},
+		Runtime: map[string]Runtime{
+			"aws": {Distribution: Lognormal, Scale: 3600, Shape: 1, Max: 86400},
+			"csc": {Distribution: Pareto, Scale: 1800, Shape: 1.5},
+		},
+		Tags:       map[string]float64{"": 2, "aws": 1, "csc": 1},
+		Priorities: []PriorityClass{{Priority: 1, Weight: 1, Slack: 2}, {Priority: 10, Weight: 3}},
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	start := time.Date(2017, 11, 24, 0, 0, 0, 0, time.UTC)
+	spec := testSpec()
+	jobs, err := Generate(spec, start, 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) == 0 {
+		t.Fatal("no jobs were generated")
+	}
+	again, err := Generate(spec, start, 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(jobs, again) {
+		t.Error("the same spec and seed generated different jobs")
+	}
+
+	end := start.Add(72 * time.Hour)
+	for i, job := range jobs {
+		if job.Created.Before(start) || !job.Created.Before(end) {
+			t.Errorf("job %d arrived at %v, outside the arrival period", i, job.Created)
+		}
+		if i > 0 && job.Created.Before(jobs[i-1].Created) {
+			t.Errorf("job %d arrived before job %d", i, i-1)
+		}
+		if job.State != autoscale.QUEUED {
+			t.Errorf("job %d is %s", i, job.State)
+		}
+		if _, ok := spec.Tags[job.Tag]; !ok {
+			t.Errorf("job %d has the unknown tag %q", i, job.Tag)
+		}
+		if ms := job.ExecutionTime["aws"]; ms <= 0 || ms > 86400000 {
+			t.Errorf("job %d runs for %d ms on aws", i, ms)
+		}
+		if ms := job.ExecutionTime["csc"]; ms < 1800000 {
+			t.Errorf("job %d runs for %d ms on csc, below the Pareto minimum", i, ms)
+		}
+		switch job.Priority {
+		case 1:
+			shortest := job.ExecutionTime[job.Tag]
+			if job.Tag == "" {
+				shortest = job.ExecutionTime["aws"]
+				if ms := job.ExecutionTime["csc"]; ms < shortest {
+					shortest = ms
+				}
+			}
+			if want := job.Created.Add(time.Duration(2*shortest) * time.Millisecond); !job.Deadline.Equal(want) {
+				t.Errorf("job %d has the deadline %v, want %v", i, job.Deadline, want)
+			}
+		case 10:
+			if !job.Deadline.IsZero() {
+				t.Errorf("job %d of a class without slack has a deadline", i)
+			}
+		default:
+			t.Errorf("job %d has the unknown priority %d", i, job.Priority)
+		}
+	}
+
+	spec.MaxJobs = 3
+	spec.Seed = 12
+	limited, err := Generate(spec, start, 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(limited) != 3 {
+		t.Errorf("generated %d jobs, want 3", len(limited))
+	}
+}
+
+func TestArrivalRate(t *testing.T) {
+	//A Saturday and a Monday at the peak hour
+	saturday := time.Date(2017, 11, 25, 14, 0, 0, 0, time.UTC)
+	monday := time.Date(2017, 11, 27, 14, 0, 0, 0, time.UTC)
+	tests := []struct {
+		arrival Arrival
+		at      time.Time
+		want    float64
+	}{
+		{Arrival{Pattern: Poisson, Rate: 4}, monday, 4},
+		{Arrival{Pattern: Diurnal, Rate: 4, Amplitude: 0.5, PeakHour: 14}, monday, 6},
+		{Arrival{Pattern: Diurnal, Rate: 4, Amplitude: 0.5, PeakHour: 14}, monday.Add(12 * time.Hour), 2},
+		{Arrival{Pattern: Weekly, Rate: 4, Amplitude: 0.5, PeakHour: 14}, monday, 6},
+		{Arrival{Pattern: Weekly, Rate: 4, Amplitude: 0.5, PeakHour: 14}, saturday, 3},
+	}
+	for i, test := range tests {
+		if got := test.arrival.rate(test.at); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("%d: rate = %v, want %v", i, got, test.want)
+		}
+		if max := test.arrival.maxRate(); test.arrival.rate(test.at) > max+1e-9 {
+			t.Errorf("%d: rate is above the maximum rate %v", i, max)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(s *Spec)
+	}{
+		{"unknown pattern", func(s *Spec) { s.Arrival.Pattern = "bursty" }},
+		{"zero rate", func(s *Spec) { s.Arrival.Rate = 0 }},
+		{"amplitude above 1", func(s *Spec) { s.Arrival.Amplitude = 1.5 }},
+		{"six weekdays", func(s *Spec) { s.Arrival.Weekdays = []float64{1, 1, 1, 1, 1, 1} }},
+		{"negative weekday", func(s *Spec) { s.Arrival.Weekdays = []float64{1, 1, 1, 1, 1, -1, 1} }},
+		{"no weekday", func(s *Spec) { s.Arrival.Weekdays = []float64{0, 0, 0, 0, 0, 0, 0} }},
+		{"no runtimes", func(s *Spec) { s.Runtime = nil }},
+		{"unknown distribution", func(s *Spec) { s.Runtime["aws"] = Runtime{Distribution: "normal", Scale: 1} }},
+		{"no shape", func(s *Spec) { s.Runtime["aws"] = Runtime{Distribution: Weibull, Scale: 1} }},
+		{"negative tag weight", func(s *Spec) { s.Tags["aws"] = -1 }},
+		{"tag without runtime", func(s *Spec) { s.Tags["metapipe"] = 1 }},
+		{"negative slack", func(s *Spec) { s.Priorities[0].Slack = -1 }},
+	}
+	if err := testSpec().Validate(); err != nil {
+		t.Fatalf("the test spec is invalid: %s", err)
+	}
+	for _, test := range tests {
+		spec := testSpec()
+		test.change(&spec)
+		if err := spec.Validate(); err == nil {
+			t.Errorf("%s: the spec was accepted", test.name)
+		}
+	}
+}